@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/service"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+// runDiagram 实现 diagram 子命令：将默认流程或声明式定义导出为状态图
+//
+//	ticket diagram [-format mermaid|plantuml|dot|svg] [-guards] [-tasks] [-definition workflow.yaml]
+func runDiagram(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("diagram", flag.ContinueOnError)
+	format := fs.String("format", "mermaid", "输出格式: mermaid, plantuml, dot 或 svg（需要安装 Graphviz）")
+	guards := fs.Bool("guards", false, "在转换边上标注 Guard")
+	tasks := fs.Bool("tasks", false, "列出状态上的任务与转换边上的 Action")
+	definition := fs.String("definition", "", "声明式工作流定义文件，为空时使用内置流程")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sm, err := loadStateMachine(*definition)
+	if err != nil {
+		return err
+	}
+	return render(w, sm, *format, workflow.DiagramOptions{Guards: *guards, Tasks: *tasks})
+}
+
+// runPath 实现 path 子命令：在状态图上高亮并编号工单经过的转换
+//
+//	ticket path -ticket ticket.json [-format mermaid|plantuml|dot|svg] [-definition workflow.yaml]
+func runPath(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("path", flag.ContinueOnError)
+	format := fs.String("format", "mermaid", "输出格式: mermaid, plantuml, dot 或 svg（需要安装 Graphviz）")
+	ticketFile := fs.String("ticket", "", "工单 JSON 文件，- 表示标准输入")
+	definition := fs.String("definition", "", "声明式工作流定义文件，为空时使用内置流程")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ticketFile == "" {
+		return errors.New("path: -ticket is required")
+	}
+
+	var data []byte
+	var err error
+	if *ticketFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*ticketFile)
+	}
+	if err != nil {
+		return err
+	}
+	var ticket model.Ticket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return fmt.Errorf("path: %s: %w", *ticketFile, err)
+	}
+
+	sm, err := loadStateMachine(*definition)
+	if err != nil {
+		return err
+	}
+	return render(w, sm, *format, workflow.DiagramOptions{Ticket: &ticket})
+}
+
+// runLint 实现 lint 子命令：对默认流程或声明式定义做静态检查，每行输出一个问题
+//
+//	ticket lint [-definition workflow.yaml]
+func runLint(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	definition := fs.String("definition", "", "声明式工作流定义文件，为空时使用内置流程")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	sm, err := loadStateMachine(*definition)
+	if err != nil {
+		return err
+	}
+	var verr *workflow.ValidationError
+	if err := sm.Validate(); errors.As(err, &verr) {
+		for _, issue := range verr.Issues {
+			fmt.Fprintln(w, issue)
+		}
+		return fmt.Errorf("lint: %d issues", len(verr.Issues))
+	}
+	return nil
+}
+
+func loadStateMachine(definition string) (*workflow.StateMachine, error) {
+	if definition == "" {
+		return service.NewStateMachine(), nil
+	}
+	def, err := workflow.LoadDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+	return workflow.NewStateMachineFromDefinition(def, service.Tasks())
+}
+
+// render 输出状态图，svg 由 Graphviz 的 dot 命令从 DOT 格式转换
+func render(w io.Writer, sm *workflow.StateMachine, format string, opts workflow.DiagramOptions) error {
+	if format != "svg" {
+		f, err := workflow.ParseDiagramFormat(format)
+		if err != nil {
+			return err
+		}
+		return sm.WriteDiagram(w, f, opts)
+	}
+
+	dot, err := exec.LookPath("dot")
+	if err != nil {
+		return fmt.Errorf("svg output requires Graphviz: %w", err)
+	}
+	var src bytes.Buffer
+	if err := sm.WriteDiagram(&src, workflow.FormatDOT, opts); err != nil {
+		return err
+	}
+	cmd := exec.Command(dot, "-Tsvg")
+	cmd.Stdin = &src
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
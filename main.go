@@ -2,33 +2,59 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"time"
+	"os"
 
 	"github.com/google/uuid"
 
 	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/rbac"
 	"github.com/kekexiaoai/ticket/service"
 	"github.com/kekexiaoai/ticket/store"
 	"github.com/kekexiaoai/ticket/workflow"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "diagram":
+			err = runDiagram(os.Args[2:], os.Stdout)
+		case "path":
+			err = runPath(os.Args[2:], os.Stdout)
+		case "lint":
+			err = runLint(os.Args[2:], os.Stdout)
+		default:
+			err = fmt.Errorf("unknown command %q (want diagram, path or lint)", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	demo()
+}
+
+// demo 演示一个工单从创建到完成的流程
+func demo() {
 	store := store.NewMockStore()
-	ts := service.NewTicketService(store)
+	policy := rbac.DefaultPolicy()
+	policy.AddUser("user456", rbac.RoleApprover)
+	policy.AddUser("admin", rbac.RoleAdmin)
+	ts := service.NewTicketService(store, service.WithPolicy(policy), service.WithTicketType("change", service.DefaultWorkflow))
 
 	// 创建工单
 	ticket := &model.Ticket{
 		ID:              uuid.New().String(),
+		Type:            "change",
 		Title:           "服务器故障",
 		Description:     "服务器无法启动",
 		Priority:        1,
 		InitialPriority: 1, // 设置初始优先级
-		CurrentState:    string(workflow.StateNew),
 		CreatorID:       "user123",
-		CreatedAt:       time.Now(),
 	}
-	if err := store.SaveTicket(context.Background(), ticket); err != nil {
+	if err := ts.CreateTicket(context.Background(), ticket); err != nil {
 		log.Fatal(err)
 	}
 
@@ -37,21 +63,24 @@ func main() {
 	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventSubmit, "user123"); err != nil {
 		log.Fatal(err)
 	}
-	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventAssign, "user456"); err != nil {
+	if err := ts.AssignTicket(ctx, ticket.ID, "user456", "user456"); err != nil {
 		log.Fatal(err)
 	}
 	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveInitial, "user456"); err != nil {
 		log.Fatal(err)
 	}
-	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventReassign, "user789"); err != nil {
+	if err := ts.ReassignTicket(ctx, ticket.ID, "user456", "user789"); err != nil {
 		log.Fatal(err)
 	}
-	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventReassign, "user999"); err != nil {
+	if err := ts.ReassignTicket(ctx, ticket.ID, "user789", "user999"); err != nil {
 		log.Fatal(err)
 	}
 	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventSubmitFinal, "user999"); err != nil {
 		log.Fatal(err)
 	}
+	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventClaimFinal, "admin"); err != nil {
+		log.Fatal(err)
+	}
 	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveFinal, "admin"); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,262 @@
+// Package migrate 将进行中的工单从一个工作流版本批量迁移到另一个版本
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/scheduler"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+// EventMigrate 迁移时写入历史的事件名，不对应任何转换
+const EventMigrate workflow.Event = "Migrate"
+
+// batchSize 每次从存储读取的工单数
+const batchSize = 500
+
+// conflictRetries 保存工单遇到版本冲突时重新读取并迁移的次数
+const conflictRetries = 3
+
+// Plan 描述一次迁移：类型为 Type 的工单从工作流 Workflow 的 From 版本迁移到 To 版本
+type Plan struct {
+	Type     string // 工单类型，为空表示未设置类型的工单
+	Workflow string
+	From     string
+	To       string
+	// States 旧状态到新状态的映射。键可以是复合状态，其下没有单独列出的子状态都按它映射；
+	// 未列出的状态如果在新版本中同名存在则保持不变，否则无法迁移。映射到复合状态时进入其初始子状态。
+	States map[workflow.State]workflow.State
+}
+
+// Result 单个工单的迁移结果
+type Result struct {
+	TicketID string
+	From     workflow.State
+	To       workflow.State // 无法迁移时为空
+	Reason   string         // 无法迁移的原因
+}
+
+// Report 迁移报告
+type Report struct {
+	DryRun     bool
+	Migrated   []Result
+	Unmappable []Result
+	Conflicts  []Result // 重试后仍被并发修改、未能迁移的工单，可以重新运行迁移
+}
+
+// Print 以表格形式输出报告
+func (r *Report) Print(w io.Writer) {
+	verb := "已迁移"
+	if r.DryRun {
+		verb = "将迁移"
+	}
+	fmt.Fprintf(w, "%s %d 个工单，%d 个无法迁移，%d 个版本冲突\n", verb, len(r.Migrated), len(r.Unmappable), len(r.Conflicts))
+	for _, res := range r.Migrated {
+		fmt.Fprintf(w, "  %s: %s -> %s\n", res.TicketID, res.From, res.To)
+	}
+	for _, res := range r.Unmappable {
+		fmt.Fprintf(w, "  %s: %s 无法迁移: %s\n", res.TicketID, res.From, res.Reason)
+	}
+	for _, res := range r.Conflicts {
+		fmt.Fprintf(w, "  %s: %s 版本冲突: %s\n", res.TicketID, res.From, res.Reason)
+	}
+}
+
+// Migrator 基于 store.TicketStore 与 workflow.Registry 执行迁移。
+// 保存时依赖工单版本检查，与服务的并发转换冲突时重新读取工单再迁移
+type Migrator struct {
+	store     store.TicketStore
+	registry  *workflow.Registry
+	scheduler *scheduler.Scheduler
+}
+
+// Option 配置 Migrator
+type Option func(*Migrator)
+
+// WithScheduler 在迁移每个工单后按新版本重新调度定时器。迁移会使旧的定时器失效，
+// 服务使用 Scheduler 时应传入同一个 Scheduler
+func WithScheduler(s *scheduler.Scheduler) Option {
+	return func(m *Migrator) {
+		m.scheduler = s
+	}
+}
+
+func New(store store.TicketStore, registry *workflow.Registry, opts ...Option) *Migrator {
+	m := &Migrator{store: store, registry: registry}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// DryRun 返回按 plan 迁移时每个工单的去向，不修改存储
+func (m *Migrator) DryRun(ctx context.Context, plan Plan) (*Report, error) {
+	return m.run(ctx, plan, "", true)
+}
+
+// Migrate 按 plan 迁移所有处于 From 版本的工单，并为每个工单记录一条由 actor 触发的 Migrate 历史。
+// 已结束的工单不迁移；无法迁移或版本冲突重试用尽的工单保持不变并出现在报告中。
+func (m *Migrator) Migrate(ctx context.Context, plan Plan, actor string) (*Report, error) {
+	return m.run(ctx, plan, actor, false)
+}
+
+func (m *Migrator) run(ctx context.Context, plan Plan, actor string, dryRun bool) (*Report, error) {
+	from, err := m.registry.Get(plan.Workflow, plan.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := m.registry.Get(plan.Workflow, plan.To)
+	if err != nil {
+		return nil, err
+	}
+	for old, next := range plan.States {
+		if !from.HasState(old) {
+			return nil, fmt.Errorf("migrate: %s is not in %s %s", old, plan.Workflow, plan.From)
+		}
+		if !to.HasState(next) {
+			return nil, fmt.Errorf("migrate: %s is mapped to %s, which is not in %s %s", old, next, plan.Workflow, plan.To)
+		}
+	}
+
+	report := &Report{DryRun: dryRun}
+	// 按 ID 分页遍历，迁移已读取的工单不影响后续页
+	q := store.Query{Limit: batchSize}
+	for {
+		page, err := m.store.ListTickets(ctx, q)
+		if err != nil {
+			return report, err
+		}
+		if err := m.migratePage(ctx, page.Tickets, plan, from, to, actor, report); err != nil {
+			return report, err
+		}
+		if page.NextCursor == "" {
+			return report, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// migratePage 迁移一页工单，结果记录在 report 中
+func (m *Migrator) migratePage(ctx context.Context, tickets []*model.Ticket, plan Plan, from, to *workflow.StateMachine, actor string, report *Report) error {
+	for _, ticket := range tickets {
+		if err := m.migrateTicket(ctx, ticket, plan, from, to, actor, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTicket 迁移一个工单，结果记录在 report 中。工单在读取后被修改时重新读取并判断，
+// 最多重试 conflictRetries 次，仍然冲突时记录在 report.Conflicts 中
+func (m *Migrator) migrateTicket(ctx context.Context, ticket *model.Ticket, plan Plan, from, to *workflow.StateMachine, actor string, report *Report) error {
+	for attempt := 0; ; attempt++ {
+		res, ok := m.target(ticket, plan, from, to)
+		switch {
+		case !ok:
+			return nil
+		case res.To == "":
+			report.Unmappable = append(report.Unmappable, res)
+			return nil
+		case report.DryRun:
+			report.Migrated = append(report.Migrated, res)
+			return nil
+		}
+
+		next := migrated(ticket, plan, res.To, actor)
+		err := m.store.SaveTicket(ctx, next)
+		if err == nil {
+			report.Migrated = append(report.Migrated, res)
+			return m.schedule(ctx, to, next)
+		}
+		if !errors.Is(err, store.ErrVersionConflict) {
+			return fmt.Errorf("migrate %s: %w", ticket.ID, err)
+		}
+		if attempt >= conflictRetries {
+			res.To, res.Reason = "", err.Error()
+			report.Conflicts = append(report.Conflicts, res)
+			return nil
+		}
+		if ticket, err = m.store.GetTicket(ctx, res.TicketID); err != nil {
+			return fmt.Errorf("migrate %s: %w", res.TicketID, err)
+		}
+	}
+}
+
+// target 返回工单的迁移结果，无法迁移时 Result.To 为空。
+// 工单不属于本次迁移（类型或版本不同）或已经结束时 ok 为 false
+func (m *Migrator) target(ticket *model.Ticket, plan Plan, from, to *workflow.StateMachine) (Result, bool) {
+	if ticket.Type != plan.Type {
+		return Result{}, false
+	}
+	// 未记录版本的工单与 Registry 一样视为最早的版本
+	if sm, err := m.registry.Get(plan.Workflow, ticket.WorkflowVersion); err != nil || sm != from {
+		return Result{}, false
+	}
+	current := workflow.State(ticket.CurrentState)
+	if from.IsTerminal(current) {
+		return Result{}, false
+	}
+	next, ok := mapping(plan, from, current)
+	if !ok {
+		next = current
+	}
+	if !to.HasState(next) {
+		return Result{TicketID: ticket.ID, From: current, Reason: fmt.Sprintf("state %s does not exist in %s", current, plan.To)}, true
+	}
+	return Result{TicketID: ticket.ID, From: current, To: to.Resolve(next)}, true
+}
+
+// mapping 返回 current 在 plan.States 中的映射：优先使用 current 本身，其次是最近的列出的祖先
+func mapping(plan Plan, from *workflow.StateMachine, current workflow.State) (workflow.State, bool) {
+	var key workflow.State
+	found := false
+	for k := range plan.States {
+		// 匹配的键都是 current 的祖先，位于同一条链上，内层的更具体
+		if from.IsIn(current, k) && (!found || from.IsIn(k, key)) {
+			key, found = k, true
+		}
+	}
+	if !found {
+		return "", false
+	}
+	return plan.States[key], true
+}
+
+// schedule 按新版本为迁移后的工单调度定时器
+func (m *Migrator) schedule(ctx context.Context, to *workflow.StateMachine, ticket *model.Ticket) error {
+	if m.scheduler == nil {
+		return nil
+	}
+	if err := m.scheduler.Schedule(ctx, to, ticket); err != nil {
+		return fmt.Errorf("migrate %s: saved but timers not scheduled: %w", ticket.ID, err)
+	}
+	return nil
+}
+
+// migrated 返回迁移后的工单副本：切换版本与状态、记录历史，并丢弃旧状态上的会签投票。
+// 状态不变时同样记录 FromState 等于 ToState 的 Migrate 历史，EnteredAt 只把转换表中的自循环视为重新进入，
+// 这条历史不会重置进入状态的时间，定时器仍按原来的截止时间触发
+func migrated(ticket *model.Ticket, plan Plan, next workflow.State, actor string) *model.Ticket {
+	c := ticket.Clone()
+	c.WorkflowVersion = plan.To
+	c.History = append(c.History, model.History{
+		FromState:   c.CurrentState,
+		ToState:     string(next),
+		Event:       string(EventMigrate),
+		Timestamp:   time.Now(),
+		TriggeredBy: actor,
+		Payload:     model.Payload{Comment: fmt.Sprintf("工作流 %s %s -> %s", plan.Workflow, plan.From, plan.To)},
+	})
+	if c.CurrentState != string(next) {
+		c.Approvals = nil
+	}
+	c.CurrentState = string(next)
+	c.UpdatedAt = time.Now()
+	return c
+}
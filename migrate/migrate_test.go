@@ -0,0 +1,326 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/scheduler"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+const v2 = `
+name: ticket
+version: v2
+states:
+  - name: New
+  - name: Pending
+  - name: Triage
+    timers:
+      - {name: TriageSLA, after: 8h, event: Approve}
+  - name: InProgress
+    initial: Working
+  - name: Working
+    parent: InProgress
+  - name: Blocked
+    parent: InProgress
+  - name: Done
+transitions:
+  - {from: New, event: Submit, to: Pending}
+  - {from: Pending, event: Assign, to: Triage}
+  - {from: Triage, event: Approve, to: InProgress}
+  - {from: Working, event: Block, to: Blocked}
+  - {from: Working, event: Finish, to: Done}
+`
+
+func newTestMigrator(t *testing.T) (*Migrator, *store.MockStore) {
+	t.Helper()
+	registry := workflow.NewRegistry()
+	if err := registry.Register("ticket", "v1", workflow.NewStateMachine()); err != nil {
+		t.Fatal(err)
+	}
+	def, err := workflow.ParseDefinition([]byte(v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RegisterDefinition(def, workflow.NewTaskRegistry()); err != nil {
+		t.Fatal(err)
+	}
+
+	mockStore := store.NewMockStore()
+	for _, ticket := range []*model.Ticket{
+		{ID: "t1", CurrentState: "InitialReview", WorkflowVersion: "v1"},
+		{ID: "t2", CurrentState: "OnHold", WorkflowVersion: "v1"},
+		{ID: "t3", CurrentState: "FinalApproval", WorkflowVersion: "v1"},
+		{ID: "t4", CurrentState: "Triage", WorkflowVersion: "v2"},
+		{ID: "t5", CurrentState: "Pending"},
+		{ID: "t6", CurrentState: "Completed", WorkflowVersion: "v1"},
+		{ID: "t7", Type: "incident", CurrentState: "InitialReview", WorkflowVersion: "v1"},
+		{ID: "t8", CurrentState: "Closed", WorkflowVersion: "v1"},
+	} {
+		ticket.CreatedAt = time.Now()
+		if err := mockStore.SaveTicket(context.Background(), ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(mockStore, registry), mockStore
+}
+
+var testPlan = Plan{
+	Workflow: "ticket",
+	From:     "v1",
+	To:       "v2",
+	States: map[workflow.State]workflow.State{
+		"InitialReview": "Triage",
+		"OnHold":        "Blocked",
+		"Completed":     "Done",
+		"Working":       "InProgress",
+	},
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	m, mockStore := newTestMigrator(t)
+	report, err := m.DryRun(context.Background(), testPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Result{
+		{TicketID: "t1", From: "InitialReview", To: "Triage"},
+		{TicketID: "t2", From: "OnHold", To: "Blocked"},
+		{TicketID: "t5", From: "Pending", To: "Pending"},
+		{TicketID: "t6", From: "Completed", To: "Done"},
+	}
+	if !reflect.DeepEqual(report.Migrated, want) {
+		t.Errorf("Migrated = %+v, want %+v", report.Migrated, want)
+	}
+	if len(report.Unmappable) != 1 || report.Unmappable[0].TicketID != "t3" {
+		t.Errorf("Unmappable = %+v, want t3", report.Unmappable)
+	}
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	if !strings.Contains(buf.String(), "t3: FinalApproval 无法迁移") {
+		t.Errorf("Print() = %q, want the unmappable ticket listed", buf.String())
+	}
+
+	t1, _ := mockStore.GetTicket(context.Background(), "t1")
+	if t1.CurrentState != "InitialReview" || t1.WorkflowVersion != "v1" || len(t1.History) != 0 {
+		t.Errorf("dry run modified ticket: %+v", t1)
+	}
+}
+
+func TestMigrator_Migrate(t *testing.T) {
+	m, mockStore := newTestMigrator(t)
+	ctx := context.Background()
+	report, err := m.Migrate(ctx, testPlan, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Migrated) != 4 || len(report.Unmappable) != 1 {
+		t.Fatalf("report = %+v, want 4 migrated and 1 unmappable", report)
+	}
+
+	t1, _ := mockStore.GetTicket(ctx, "t1")
+	if t1.CurrentState != "Triage" || t1.WorkflowVersion != "v2" {
+		t.Errorf("t1 = %s %s, want Triage v2", t1.CurrentState, t1.WorkflowVersion)
+	}
+	if len(t1.History) != 1 {
+		t.Fatalf("t1 history = %+v, want one Migrate entry", t1.History)
+	}
+	if h := t1.History[0]; h.Event != string(EventMigrate) || h.FromState != "InitialReview" || h.ToState != "Triage" || h.TriggeredBy != "admin" {
+		t.Errorf("t1 history = %+v", h)
+	}
+	t3, _ := mockStore.GetTicket(ctx, "t3")
+	if t3.CurrentState != "FinalApproval" || t3.WorkflowVersion != "v1" {
+		t.Errorf("unmappable ticket modified: %+v", t3)
+	}
+
+	// 迁移后的工单按 v2 运行
+	report, err = m.Migrate(ctx, testPlan, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Migrated) != 0 {
+		t.Errorf("second Migrate() migrated %+v, want none", report.Migrated)
+	}
+}
+
+func TestMigrator_InvalidPlan(t *testing.T) {
+	m, _ := newTestMigrator(t)
+	plan := testPlan
+	plan.States = map[workflow.State]workflow.State{"InitialReview": "Review"}
+	if _, err := m.DryRun(context.Background(), plan); err == nil {
+		t.Error("DryRun() with unknown target state error = nil")
+	}
+	plan.States = map[workflow.State]workflow.State{"Review": "Triage"}
+	if _, err := m.DryRun(context.Background(), plan); err == nil {
+		t.Error("DryRun() with unknown source state error = nil")
+	}
+	plan.To = "v3"
+	if _, err := m.DryRun(context.Background(), plan); err == nil {
+		t.Error("DryRun() with unknown version error = nil")
+	}
+}
+
+func TestMigrator_CompositeStates(t *testing.T) {
+	m, mockStore := newTestMigrator(t)
+	ctx := context.Background()
+	if err := mockStore.SaveTicket(ctx, &model.Ticket{ID: "t9", CurrentState: "Submitted", WorkflowVersion: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	plan := testPlan
+	plan.States = map[workflow.State]workflow.State{
+		"InProgress": "InProgress",
+		"OnHold":     "Blocked",
+	}
+	report, err := m.DryRun(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]workflow.State)
+	for _, res := range report.Migrated {
+		got[res.TicketID] = res.To
+	}
+	// 子状态单独列出时优先于复合状态，其余子状态按复合状态映射
+	if got["t2"] != "Blocked" || got["t9"] != "Working" {
+		t.Errorf("Migrated = %+v, want t2 to Blocked and t9 to Working", report.Migrated)
+	}
+}
+
+const review = `
+name: review
+version: %s
+states:
+  - name: Open
+  - name: Review
+    timers:
+      - {name: SLA, after: 24h, event: Expire}
+  - name: Expired
+transitions:
+  - {from: Open, event: Submit, to: Review}
+  - {from: Review, event: Expire, to: Expired}
+`
+
+func TestMigrator_SameStateKeepsTimers(t *testing.T) {
+	registry := workflow.NewRegistry()
+	for _, version := range []string{"v1", "v2"} {
+		def, err := workflow.ParseDefinition([]byte(fmt.Sprintf(review, version)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := registry.RegisterDefinition(def, workflow.NewTaskRegistry()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	entered := time.Now().Add(-2 * time.Hour)
+	mockStore := store.NewMockStore()
+	ticket := &model.Ticket{ID: "t1", CurrentState: "Review", WorkflowVersion: "v1", CreatedAt: entered,
+		History: []model.History{{FromState: "Open", ToState: "Review", Event: "Submit", Timestamp: entered}}}
+	if err := mockStore.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Now()}
+	sched := scheduler.New(scheduler.NewMemoryTimerStore(), clock)
+	m := New(mockStore, registry, WithScheduler(sched))
+
+	if _, err := m.Migrate(ctx, Plan{Workflow: "review", From: "v1", To: "v2"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := registry.Get("review", "v2")
+	migrated, _ := mockStore.GetTicket(ctx, "t1")
+	if got, ok := v2.EnteredAt(migrated, "Review"); !ok || !got.Equal(entered) {
+		t.Errorf("EnteredAt() = %v, %v, want %v", got, ok, entered)
+	}
+
+	// 定时器仍从最初进入 Review 时开始计时
+	firer := &recordingFirer{}
+	clock.now = entered.Add(23 * time.Hour)
+	if n, err := sched.RunDue(ctx, firer); n != 0 || err != nil {
+		t.Errorf("RunDue() before the deadline = %d, %v, want 0, nil", n, err)
+	}
+	clock.now = entered.Add(25 * time.Hour)
+	if n, err := sched.RunDue(ctx, firer); n != 1 || err != nil {
+		t.Errorf("RunDue() after the deadline = %d, %v, want 1, nil", n, err)
+	}
+}
+
+// racingStore 在保存前按 races 抢先修改存储中的工单，模拟服务的并发转换
+type racingStore struct {
+	*store.MockStore
+	races map[string][]string // 工单 ID 到每次抢先写入的状态
+}
+
+func (s *racingStore) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
+	if states := s.races[ticket.ID]; len(states) > 0 {
+		s.races[ticket.ID] = states[1:]
+		stored, err := s.MockStore.GetTicket(ctx, ticket.ID)
+		if err != nil {
+			return err
+		}
+		stored.CurrentState = states[0]
+		if err := s.MockStore.SaveTicket(ctx, stored); err != nil {
+			return err
+		}
+	}
+	return s.MockStore.SaveTicket(ctx, ticket)
+}
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestMigrator_ConflictsAndTimers(t *testing.T) {
+	base, mockStore := newTestMigrator(t)
+	racing := &racingStore{MockStore: mockStore, races: map[string][]string{
+		"t1": {"InitialReview"},                        // 冲突一次，重新读取后迁移
+		"t2": {"OnHold", "OnHold", "OnHold", "OnHold"}, // 重试用尽
+		"t5": {"Canceled"},                             // 重新读取后已结束，跳过
+	}}
+	clock := &fakeClock{now: time.Now()}
+	sched := scheduler.New(scheduler.NewMemoryTimerStore(), clock)
+	m := New(racing, base.registry, WithScheduler(sched))
+
+	ctx := context.Background()
+	report, err := m.Migrate(ctx, testPlan, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrated []string
+	for _, res := range report.Migrated {
+		migrated = append(migrated, res.TicketID)
+	}
+	if want := []string{"t1", "t6"}; !reflect.DeepEqual(migrated, want) {
+		t.Errorf("Migrated = %v, want %v", migrated, want)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].TicketID != "t2" || !strings.Contains(report.Conflicts[0].Reason, "version conflict") {
+		t.Errorf("Conflicts = %+v, want t2", report.Conflicts)
+	}
+	if t5, _ := mockStore.GetTicket(ctx, "t5"); t5.CurrentState != "Canceled" || t5.WorkflowVersion != "" {
+		t.Errorf("t5 = %s %q, want Canceled and not migrated", t5.CurrentState, t5.WorkflowVersion)
+	}
+
+	// 迁移到 Triage 的工单按 v2 的定时器调度，截止时间从迁移时开始计算
+	clock.now = clock.now.Add(9 * time.Hour)
+	firer := &recordingFirer{}
+	if n, err := sched.RunDue(ctx, firer); n != 1 || err != nil {
+		t.Fatalf("RunDue() = %d, %v, want 1, nil", n, err)
+	}
+	if e := firer.fired[0]; e.TicketID != "t1" || e.Timer != "TriageSLA" {
+		t.Errorf("fired %+v, want the t1 TriageSLA timer", e)
+	}
+}
+
+type recordingFirer struct{ fired []scheduler.Entry }
+
+func (f *recordingFirer) FireTimer(ctx context.Context, e scheduler.Entry) error {
+	f.fired = append(f.fired, e)
+	return nil
+}
@@ -7,18 +7,22 @@ import (
 )
 
 type Ticket struct {
-	ID              string    `json:"id"`
-	Title           string    `json:"title"`
-	Description     string    `json:"description"`
-	Priority        int       `json:"priority"`
-	InitialPriority int       `json:"initial_priority"` // 新增字段
-	ReassignCount   int       `json:"reassign_count"`
-	CurrentState    string    `json:"current_state"`
-	CreatorID       string    `json:"creator_id"`
-	AssigneeID      string    `json:"assignee_id"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
-	History         []History `json:"history"`
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Type            string     `json:"type,omitempty"` // 工单类型，决定使用的工作流，为空时使用默认工作流
+	Priority        int        `json:"priority"`
+	InitialPriority int        `json:"initial_priority"` // 新增字段
+	ReassignCount   int        `json:"reassign_count"`
+	CurrentState    string     `json:"current_state"`
+	WorkflowVersion string     `json:"workflow_version,omitempty"` // 创建时的工作流版本，为空表示版本化之前的工单
+	Version         int64      `json:"version"`                    // 乐观锁版本号，每次保存成功后由存储加一，新工单为 0
+	CreatorID       string     `json:"creator_id"`
+	AssigneeID      string     `json:"assignee_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	History         []History  `json:"history"`
+	Approvals       []Approval `json:"approvals,omitempty"` // 会签状态本轮的投票，重新进入该状态时清空
 }
 
 type History struct {
@@ -27,6 +31,48 @@ type History struct {
 	Event       string    `json:"event"`
 	Timestamp   time.Time `json:"timestamp"`
 	TriggeredBy string    `json:"triggered_by"`
+	Payload     Payload   `json:"payload,omitzero"`
+}
+
+// 会签投票结果
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// Approval 审批人在会签状态上的一次投票
+type Approval struct {
+	State     string    `json:"state"`
+	Approver  string    `json:"approver"`
+	Decision  string    `json:"decision"`
+	Comment   string    `json:"comment,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Payload 事件附带的数据，随转换传入每个任务并记录在历史中
+type Payload struct {
+	Assignee  string    `json:"assignee,omitempty"`  // Assign/Reassign 的目标处理人
+	Reason    string    `json:"reason,omitempty"`    // 打回、拒绝等操作的原因
+	Comment   string    `json:"comment,omitempty"`   // 备注
+	HoldUntil time.Time `json:"hold_until,omitzero"` // Hold 的挂起截止时间
+}
+
+// String 返回非空字段的简短描述，用于打印历史
+func (p Payload) String() string {
+	var parts []string
+	if p.Assignee != "" {
+		parts = append(parts, "处理人="+p.Assignee)
+	}
+	if p.Reason != "" {
+		parts = append(parts, "原因="+p.Reason)
+	}
+	if p.Comment != "" {
+		parts = append(parts, "备注="+p.Comment)
+	}
+	if !p.HoldUntil.IsZero() {
+		parts = append(parts, "挂起至="+p.HoldUntil.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, ", ")
 }
 
 func (t *Ticket) PrintHistory() {
@@ -35,16 +81,26 @@ func (t *Ticket) PrintHistory() {
 		return
 	}
 	fmt.Printf("工单 %s 的历史记录 (初始优先级: %d, 当前优先级: %d, 转交次数: %d):\n", t.ID, t.InitialPriority, t.Priority, t.ReassignCount)
-	fmt.Println("时间                  | 事件            | 从状态            | 到状态            | 触发者")
+	fmt.Println("时间                  | 事件            | 从状态            | 到状态            | 触发者    | 说明")
 	fmt.Println(strings.Repeat("-", 80))
 	for _, h := range t.History {
-		fmt.Printf("%s | %-15s | %-17s | %-17s | %s\n",
+		line := fmt.Sprintf("%s | %-15s | %-17s | %-17s | %-9s | %s",
 			h.Timestamp.Format("2006-01-02 15:04:05"),
 			h.Event,
 			h.FromState,
 			h.ToState,
 			h.TriggeredBy,
+			h.Payload,
 		)
+		fmt.Println(strings.TrimRight(line, " |"))
 	}
 	fmt.Println(strings.Repeat("-", 80))
 }
+
+// Clone 返回工单的深拷贝
+func (t *Ticket) Clone() *Ticket {
+	c := *t
+	c.History = append([]History(nil), t.History...)
+	c.Approvals = append([]Approval(nil), t.Approvals...)
+	return &c
+}
@@ -0,0 +1,187 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+// ErrPermissionDenied actor 的所有角色都没有被授予该权限，与 workflow.ErrPermissionDenied 相同
+var ErrPermissionDenied = workflow.ErrPermissionDenied
+
+// 内置角色
+const (
+	RoleCreator  = "creator"  // 动态角色：工单的创建人
+	RoleAssignee = "assignee" // 动态角色：工单的当前处理人
+	RoleSystem   = "system"   // 动态角色：workflow.SystemActor，例如定时器
+	RoleApprover = "approver"
+	RoleAdmin    = "admin"
+)
+
+// AnyState 授权时匹配任意状态
+const AnyState workflow.State = "*"
+
+// PolicyStore 提供用户角色与角色权限
+type PolicyStore interface {
+	// UserRoles 返回用户被静态授予的角色，未知用户返回空
+	UserRoles(ctx context.Context, userID string) ([]string, error)
+	// Allowed 判断角色能否在 state 上触发 event
+	Allowed(ctx context.Context, role string, state workflow.State, event workflow.Event) (bool, error)
+}
+
+// Enforcer 基于 PolicyStore 实现 workflow.Authorizer
+type Enforcer struct {
+	store PolicyStore
+}
+
+func NewEnforcer(store PolicyStore) *Enforcer {
+	return &Enforcer{store: store}
+}
+
+// Roles 返回 actor 对该工单拥有的全部角色，包括 system、creator、assignee 动态角色
+func (e *Enforcer) Roles(ctx context.Context, ticket *model.Ticket, actor string) ([]string, error) {
+	roles, err := e.store.UserRoles(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	roles = append([]string(nil), roles...)
+	if actor == workflow.SystemActor {
+		roles = append(roles, RoleSystem)
+	}
+	if actor != "" && ticket.CreatorID == actor {
+		roles = append(roles, RoleCreator)
+	}
+	if actor != "" && ticket.AssigneeID == actor {
+		roles = append(roles, RoleAssignee)
+	}
+	return roles, nil
+}
+
+// Authorize 只要 actor 的任一角色被授予权限即放行
+func (e *Enforcer) Authorize(ctx context.Context, ticket *model.Ticket, state workflow.State, event workflow.Event, actor string) error {
+	roles, err := e.Roles(ctx, ticket, actor)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		ok, err := e.store.Allowed(ctx, role, state, event)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return ErrPermissionDenied
+}
+
+type grant struct {
+	role  string
+	state workflow.State
+	event workflow.Event
+}
+
+// MemoryPolicyStore 内存中的策略存储
+type MemoryPolicyStore struct {
+	mu     sync.RWMutex
+	users  map[string][]string
+	grants map[grant]bool
+}
+
+func NewMemoryPolicyStore() *MemoryPolicyStore {
+	return &MemoryPolicyStore{
+		users:  make(map[string][]string),
+		grants: make(map[grant]bool),
+	}
+}
+
+// AddUser 为用户添加角色
+func (s *MemoryPolicyStore) AddUser(userID string, roles ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[userID] = append(s.users[userID], roles...)
+}
+
+// Grant 允许 role 在 state 上触发 events，state 为 AnyState 时匹配任意状态
+func (s *MemoryPolicyStore) Grant(role string, state workflow.State, events ...workflow.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		s.grants[grant{role, state, event}] = true
+	}
+}
+
+// Revoke 撤销 Grant 授予的权限
+func (s *MemoryPolicyStore) Revoke(role string, state workflow.State, events ...workflow.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		delete(s.grants, grant{role, state, event})
+	}
+}
+
+func (s *MemoryPolicyStore) UserRoles(ctx context.Context, userID string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.users[userID]...), nil
+}
+
+func (s *MemoryPolicyStore) Allowed(ctx context.Context, role string, state workflow.State, event workflow.Event) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.grants[grant{role, state, event}] || s.grants[grant{role, AnyState, event}], nil
+}
+
+// DefaultPolicy 返回默认审批流程的授权，不包含任何用户
+func DefaultPolicy() *MemoryPolicyStore {
+	s := NewMemoryPolicyStore()
+	s.Grant(RoleCreator, workflow.StateNew, workflow.EventSubmit)
+	s.Grant(RoleCreator, workflow.StatePending, workflow.EventCancel)
+	s.Grant(RoleApprover, workflow.StatePending, workflow.EventAssign)
+	s.Grant(RoleApprover, workflow.StateInitialReview, workflow.EventApproveInitial, workflow.EventRejectInitial, workflow.EventDenyInitial)
+	s.Grant(RoleAssignee, workflow.StateWorking, workflow.EventReassign, workflow.EventHold, workflow.EventSubmitFinal)
+	s.Grant(RoleAssignee, workflow.StateOnHold, workflow.EventResume)
+	s.Grant(RoleAdmin, workflow.StateWorking, workflow.EventReassign)
+	s.Grant(RoleAdmin, workflow.StateSubmitted, workflow.EventClaimFinal)
+	s.Grant(RoleAdmin, workflow.StateFinalApproval, workflow.EventApproveFinal, workflow.EventRejectFinal)
+	s.Grant(RoleAdmin, workflow.StateCompleted, workflow.EventArchive)
+	s.Grant(RoleSystem, workflow.StatePending, workflow.EventCancel)
+	s.Grant(RoleSystem, workflow.StateInitialReview, workflow.EventEscalate)
+	return s
+}
+
+// policyDocument 策略文件格式（YAML 或 JSON）
+type policyDocument struct {
+	Users  map[string][]string `yaml:"users"`
+	Grants []struct {
+		Role   string   `yaml:"role"`
+		State  string   `yaml:"state"`
+		Events []string `yaml:"events"`
+	} `yaml:"grants"`
+}
+
+// ParsePolicy 从 YAML 或 JSON 文档加载策略
+func ParsePolicy(data []byte) (*MemoryPolicyStore, error) {
+	var doc policyDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("rbac policy: %w", err)
+	}
+	s := NewMemoryPolicyStore()
+	for user, roles := range doc.Users {
+		s.AddUser(user, roles...)
+	}
+	for i, g := range doc.Grants {
+		if g.Role == "" || g.State == "" || len(g.Events) == 0 {
+			return nil, fmt.Errorf("rbac policy: grant %d requires role, state and events", i)
+		}
+		for _, event := range g.Events {
+			s.Grant(g.Role, workflow.State(g.State), workflow.Event(event))
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,92 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+func TestEnforcer_Authorize(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.AddUser("alice", RoleApprover)
+	policy.AddUser("root", RoleAdmin)
+	enforcer := NewEnforcer(policy)
+
+	ticket := &model.Ticket{ID: "test-ticket", CreatorID: "bob", AssigneeID: "carol"}
+	tests := []struct {
+		name    string
+		state   workflow.State
+		event   workflow.Event
+		actor   string
+		allowed bool
+	}{
+		{"approver can ApproveInitial", workflow.StateInitialReview, workflow.EventApproveInitial, "alice", true},
+		{"creator cannot ApproveInitial", workflow.StateInitialReview, workflow.EventApproveInitial, "bob", false},
+		{"creator can Cancel from Pending", workflow.StatePending, workflow.EventCancel, "bob", true},
+		{"approver cannot Cancel", workflow.StatePending, workflow.EventCancel, "alice", false},
+		{"assignee can Hold", workflow.StateWorking, workflow.EventHold, "carol", true},
+		{"other user cannot Hold", workflow.StateWorking, workflow.EventHold, "dave", false},
+		{"admin can ApproveFinal", workflow.StateFinalApproval, workflow.EventApproveFinal, "root", true},
+		{"assignee cannot ApproveFinal", workflow.StateFinalApproval, workflow.EventApproveFinal, "carol", false},
+		{"anonymous", workflow.StateNew, workflow.EventSubmit, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enforcer.Authorize(context.Background(), ticket, tt.state, tt.event, tt.actor)
+			if tt.allowed && err != nil {
+				t.Errorf("Authorize() error = %v, want nil", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("Authorize() error = %v, want ErrPermissionDenied", err)
+			}
+		})
+	}
+}
+
+func TestMemoryPolicyStore_AnyStateAndRevoke(t *testing.T) {
+	policy := NewMemoryPolicyStore()
+	policy.AddUser("ops", "operator")
+	policy.Grant("operator", AnyState, workflow.EventCancel)
+	enforcer := NewEnforcer(policy)
+	ticket := &model.Ticket{ID: "test-ticket"}
+
+	for _, state := range []workflow.State{workflow.StatePending, workflow.StateWorking} {
+		if err := enforcer.Authorize(context.Background(), ticket, state, workflow.EventCancel, "ops"); err != nil {
+			t.Errorf("Authorize(%s) error = %v, want nil", state, err)
+		}
+	}
+	policy.Revoke("operator", AnyState, workflow.EventCancel)
+	if err := enforcer.Authorize(context.Background(), ticket, workflow.StatePending, workflow.EventCancel, "ops"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Authorize() after Revoke error = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	doc := `
+users:
+  alice: [approver]
+grants:
+  - role: approver
+    state: Pending
+    events: [Assign]
+`
+	policy, err := ParsePolicy([]byte(doc))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+	enforcer := NewEnforcer(policy)
+	ticket := &model.Ticket{ID: "test-ticket"}
+	if err := enforcer.Authorize(context.Background(), ticket, workflow.StatePending, workflow.EventAssign, "alice"); err != nil {
+		t.Errorf("Authorize(Assign) error = %v, want nil", err)
+	}
+	if err := enforcer.Authorize(context.Background(), ticket, workflow.StatePending, workflow.EventCancel, "alice"); err == nil {
+		t.Error("Authorize(Cancel) = nil, want ErrPermissionDenied")
+	}
+
+	if _, err := ParsePolicy([]byte("grants:\n  - role: approver\n")); err == nil {
+		t.Error("Expected error for incomplete grant, got nil")
+	}
+}
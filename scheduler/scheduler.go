@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+// Clock 提供当前时间，测试中可替换
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock 使用系统时间
+type RealClock struct{}
+
+func (RealClock) Now() time.Time { return time.Now() }
+
+// Entry 一个待触发的定时器
+type Entry struct {
+	TicketID  string         `json:"ticket_id"`
+	State     workflow.State `json:"state"` // 定时器注册所在的状态
+	Timer     string         `json:"timer"`
+	Event     workflow.Event `json:"event"`
+	EnteredAt time.Time      `json:"entered_at"` // 调度时工单进入 State 的时间，用于判断定时器是否过期
+	DueAt     time.Time      `json:"due_at"`
+	Attempts  int            `json:"attempts,omitempty"` // 已失败的触发次数
+}
+
+func (e Entry) key() string {
+	return e.TicketID + "/" + string(e.State) + "/" + e.Timer
+}
+
+// 触发失败后的重试间隔，每次失败翻倍，最长 MaxRetryDelay。连续失败 MaxAttempts 次后放弃
+const (
+	RetryDelay    = time.Minute
+	MaxRetryDelay = time.Hour
+	MaxAttempts   = 10
+)
+
+// permanent 判断触发错误是否重试也不会成功：工单已删除、工作流版本不存在，或转换被拒绝
+func permanent(err error) bool {
+	for _, target := range []error{store.ErrTicketNotFound, workflow.ErrUnknownWorkflow,
+		workflow.ErrInvalidTransition, workflow.ErrForbidden, workflow.ErrGuardRejected} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func retryDelay(attempts int) time.Duration {
+	d := RetryDelay
+	for i := 1; i < attempts && d < MaxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, MaxRetryDelay)
+}
+
+// Firer 触发到期的定时器，通常由 service.TicketService 实现
+type Firer interface {
+	FireTimer(ctx context.Context, e Entry) error
+}
+
+// Scheduler 根据工单状态调度定时器，并在到期时通过 Firer 触发事件
+type Scheduler struct {
+	store TimerStore
+	clock Clock
+}
+
+func New(store TimerStore, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return &Scheduler{store: store, clock: clock}
+}
+
+// Clock 返回调度器使用的时钟
+func (s *Scheduler) Clock() Clock {
+	return s.clock
+}
+
+// Schedule 根据工单当前状态重新计算其全部定时器，截止时间从进入定时器所在状态时开始计算
+func (s *Scheduler) Schedule(ctx context.Context, sm *workflow.StateMachine, ticket *model.Ticket) error {
+	var entries []Entry
+	for _, t := range sm.ActiveTimers(workflow.State(ticket.CurrentState)) {
+		enteredAt, ok := sm.EnteredAt(ticket, t.State)
+		if !ok {
+			continue
+		}
+		entries = append(entries, Entry{
+			TicketID:  ticket.ID,
+			State:     t.State,
+			Timer:     t.Name,
+			Event:     t.Event,
+			EnteredAt: enteredAt,
+			DueAt:     enteredAt.Add(t.After),
+		})
+	}
+	return s.store.Replace(ctx, ticket.ID, entries)
+}
+
+// IsStale 判断定时器是否已失效：工单已离开或重新进入了定时器所在的状态
+func IsStale(sm *workflow.StateMachine, ticket *model.Ticket, e Entry) bool {
+	enteredAt, ok := sm.EnteredAt(ticket, e.State)
+	return !ok || !enteredAt.Equal(e.EnteredAt)
+}
+
+// RunDue 触发所有到期的定时器，返回成功触发的数量。
+// 触发成功（包括 Firer 判定已失效而跳过）的定时器被删除；
+// 触发失败的定时器保留，DueAt 推迟到下次重试的时间。错误不可重试或失败次数达到 MaxAttempts 时
+// 删除定时器并记录日志。错误汇总后返回。
+func (s *Scheduler) RunDue(ctx context.Context, firer Firer) (int, error) {
+	due, err := s.store.Due(ctx, s.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	var fired int
+	var errs []error
+	for _, e := range due {
+		if err := firer.FireTimer(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("timer %s: %w", e.key(), err))
+			e.Attempts++
+			if permanent(err) || e.Attempts >= MaxAttempts {
+				log.Printf("定时器: 放弃 %s，已失败 %d 次: %v", e.key(), e.Attempts, err)
+				if err := s.store.Remove(ctx, e); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			e.DueAt = s.clock.Now().Add(retryDelay(e.Attempts))
+			if err := s.store.Update(ctx, e); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		fired++
+		if err := s.store.Remove(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return fired, errors.Join(errs...)
+}
+
+// Run 每隔 interval 调用一次 RunDue，直到 ctx 结束
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, firer Firer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunDue(ctx, firer); err != nil {
+			log.Printf("定时器: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+type recordingFirer struct {
+	fired []Entry
+	err   error
+}
+
+func (f *recordingFirer) FireTimer(ctx context.Context, e Entry) error {
+	f.fired = append(f.fired, e)
+	return f.err
+}
+
+func newTimerMachine() *workflow.StateMachine {
+	sm := workflow.NewStateMachine()
+	sm.RegisterTimers(workflow.StatePending, workflow.Timer{Name: "AutoCancel", After: 14 * 24 * time.Hour, Event: workflow.EventCancel})
+	sm.RegisterTimers(workflow.StateInProgress, workflow.Timer{Name: "SLA", After: 48 * time.Hour, Event: workflow.EventHold})
+	return sm
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	sched := New(NewMemoryTimerStore(), clock)
+	sm := newTimerMachine()
+
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		CurrentState: string(workflow.StatePending),
+		CreatedAt:    start.Add(-time.Hour),
+		History:      []model.History{{FromState: "New", ToState: "Pending", Event: "Submit", Timestamp: start}},
+	}
+	if err := sched.Schedule(context.Background(), sm, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	firer := &recordingFirer{}
+	clock.now = start.Add(13 * 24 * time.Hour)
+	if n, err := sched.RunDue(context.Background(), firer); n != 0 || err != nil {
+		t.Fatalf("RunDue() before deadline = %d, %v, want 0, nil", n, err)
+	}
+
+	clock.now = start.Add(14 * 24 * time.Hour)
+	if n, err := sched.RunDue(context.Background(), firer); n != 1 || err != nil {
+		t.Fatalf("RunDue() at deadline = %d, %v, want 1, nil", n, err)
+	}
+	got := firer.fired[0]
+	if got.TicketID != ticket.ID || got.Event != workflow.EventCancel || got.State != workflow.StatePending || !got.DueAt.Equal(clock.now) {
+		t.Errorf("fired entry = %+v", got)
+	}
+
+	// 已触发的定时器被删除
+	if n, _ := sched.RunDue(context.Background(), firer); n != 0 {
+		t.Errorf("RunDue() after firing = %d, want 0", n)
+	}
+}
+
+func TestScheduler_FailedTimerIsRetried(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	sched := New(NewMemoryTimerStore(), clock)
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(workflow.StatePending), CreatedAt: start}
+	if err := sched.Schedule(context.Background(), newTimerMachine(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = start.Add(15 * 24 * time.Hour)
+	errFire := errors.New("boom")
+	failing := &recordingFirer{err: errFire}
+	if n, err := sched.RunDue(context.Background(), failing); n != 0 || !errors.Is(err, errFire) {
+		t.Fatalf("RunDue() = %d, %v, want 0, %v", n, err, errFire)
+	}
+
+	// 失败的定时器保留，每次重试的间隔翻倍
+	for attempt, delay := range []time.Duration{RetryDelay, 2 * RetryDelay} {
+		firer := &recordingFirer{}
+		clock.now = clock.now.Add(delay - time.Second)
+		if n, _ := sched.RunDue(context.Background(), firer); n != 0 {
+			t.Fatalf("RunDue() before retry %d = %d, want 0", attempt+1, n)
+		}
+		clock.now = clock.now.Add(time.Second)
+		if attempt == 0 {
+			firer.err = errFire
+		}
+		sched.RunDue(context.Background(), firer)
+		if len(firer.fired) != 1 || firer.fired[0].Attempts != attempt+1 {
+			t.Fatalf("retry %d fired %+v, want one entry with Attempts %d", attempt+1, firer.fired, attempt+1)
+		}
+	}
+
+	// 成功触发后删除
+	clock.now = clock.now.Add(MaxRetryDelay)
+	if n, err := sched.RunDue(context.Background(), &recordingFirer{}); n != 0 || err != nil {
+		t.Errorf("RunDue() after success = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestScheduler_FailedTimerIsDropped(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"permanent error", fmt.Errorf("fire: %w", workflow.ErrForbidden), 1},
+		{"ticket deleted", store.ErrTicketNotFound, 1},
+		{"too many attempts", errors.New("boom"), MaxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: start}
+			sched := New(NewMemoryTimerStore(), clock)
+			ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(workflow.StatePending), CreatedAt: start}
+			if err := sched.Schedule(context.Background(), newTimerMachine(), ticket); err != nil {
+				t.Fatal(err)
+			}
+			clock.now = start.Add(15 * 24 * time.Hour)
+			firer := &recordingFirer{err: tt.err}
+			for i := 0; i < tt.attempts+1; i++ {
+				if _, err := sched.RunDue(context.Background(), firer); i < tt.attempts && !errors.Is(err, tt.err) {
+					t.Fatalf("RunDue() error = %v, want %v", err, tt.err)
+				}
+				clock.now = clock.now.Add(MaxRetryDelay)
+			}
+			if len(firer.fired) != tt.attempts {
+				t.Errorf("fired %d times, want %d", len(firer.fired), tt.attempts)
+			}
+		})
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	sm := newTimerMachine()
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		CurrentState: string(workflow.StateWorking),
+		History:      []model.History{{FromState: "InitialReview", ToState: "Working", Event: "ApproveInitial", Timestamp: start}},
+	}
+	sched := New(NewMemoryTimerStore(), &fakeClock{now: start})
+	if err := sched.Schedule(context.Background(), sm, ticket); err != nil {
+		t.Fatal(err)
+	}
+	due, _ := sched.store.Due(context.Background(), start.Add(48*time.Hour))
+	if len(due) != 1 || due[0].State != workflow.StateInProgress {
+		t.Fatalf("Due() = %+v, want the InProgress SLA timer", due)
+	}
+	entry := due[0]
+
+	// 在复合状态内部移动不会使父状态的定时器失效
+	ticket.History = append(ticket.History, model.History{FromState: "Working", ToState: "OnHold", Event: "Hold", Timestamp: start.Add(time.Hour)})
+	ticket.CurrentState = string(workflow.StateOnHold)
+	if IsStale(sm, ticket, entry) {
+		t.Error("IsStale() = true after moving between InProgress sub-states")
+	}
+
+	ticket.History = append(ticket.History, model.History{FromState: "OnHold", ToState: "FinalApproval", Event: "SubmitFinal", Timestamp: start.Add(2 * time.Hour)})
+	ticket.CurrentState = string(workflow.StateFinalApproval)
+	if !IsStale(sm, ticket, entry) {
+		t.Error("IsStale() = false after leaving InProgress")
+	}
+}
+
+func TestFileTimerStore_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timers.json")
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	store, err := OpenFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(workflow.StatePending), CreatedAt: start}
+	if err := New(store, &fakeClock{now: start}).Schedule(context.Background(), newTimerMachine(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := reopened.Due(context.Background(), start.Add(14*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Timer != "AutoCancel" || !due[0].EnteredAt.Equal(start) {
+		t.Fatalf("Due() after reopen = %+v, want the AutoCancel timer", due)
+	}
+
+	if err := reopened.Remove(context.Background(), due[0]); err != nil {
+		t.Fatal(err)
+	}
+	again, err := OpenFileTimerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := again.Due(context.Background(), start.Add(30*24*time.Hour)); len(due) != 0 {
+		t.Errorf("Due() after Remove = %+v, want none", due)
+	}
+}
+
+func TestFileTimerStore_FailedWriteKeepsEntries(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "timers")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	s, err := OpenFileTimerStore(filepath.Join(dir, "timers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	entry := Entry{TicketID: "t1", State: workflow.StatePending, Timer: "AutoCancel", Event: workflow.EventCancel, EnteredAt: start, DueAt: start}
+	if err := s.Replace(ctx, "t1", []Entry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目录被删除后写入失败，内存中的定时器保持不变
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	moved := entry
+	moved.DueAt, moved.Attempts = start.Add(time.Hour), 1
+	if err := s.Update(ctx, moved); err == nil {
+		t.Error("Update() error = nil, want the write error")
+	}
+	if err := s.Replace(ctx, "t2", []Entry{{TicketID: "t2", Timer: "AutoCancel", DueAt: start}}); err == nil {
+		t.Error("Replace() error = nil, want the write error")
+	}
+	if err := s.Remove(ctx, entry); err == nil {
+		t.Error("Remove() error = nil, want the write error")
+	}
+	due, _ := s.Due(ctx, start)
+	if len(due) != 1 || due[0] != entry {
+		t.Errorf("Due() after failed writes = %+v, want only %+v", due, entry)
+	}
+}
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimerStore 持久化待触发的定时器
+type TimerStore interface {
+	// Replace 用 entries 替换工单现有的全部定时器
+	Replace(ctx context.Context, ticketID string, entries []Entry) error
+	// Due 返回 DueAt 不晚于 now 的定时器，按 DueAt 排序
+	Due(ctx context.Context, now time.Time) ([]Entry, error)
+	// Remove 删除一个定时器，不存在时不报错
+	Remove(ctx context.Context, e Entry) error
+	// Update 更新一个定时器的 DueAt 与 Attempts，定时器已被重新调度或删除时不报错
+	Update(ctx context.Context, e Entry) error
+}
+
+// MemoryTimerStore 内存中的定时器存储，重启后丢失
+type MemoryTimerStore struct {
+	mu      sync.Mutex
+	entries map[string][]Entry // 按 TicketID 分组
+}
+
+func NewMemoryTimerStore() *MemoryTimerStore {
+	return &MemoryTimerStore{entries: make(map[string][]Entry)}
+}
+
+func (s *MemoryTimerStore) Replace(ctx context.Context, ticketID string, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replace(ticketID, entries)
+	return nil
+}
+
+func (s *MemoryTimerStore) replace(ticketID string, entries []Entry) {
+	if len(entries) == 0 {
+		delete(s.entries, ticketID)
+		return
+	}
+	s.entries[ticketID] = append([]Entry(nil), entries...)
+}
+
+func (s *MemoryTimerStore) Due(ctx context.Context, now time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Entry
+	for _, entries := range s.entries {
+		for _, e := range entries {
+			if !e.DueAt.After(now) {
+				due = append(due, e)
+			}
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].DueAt.Before(due[j].DueAt) })
+	return due, nil
+}
+
+func (s *MemoryTimerStore) Remove(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(e)
+	return nil
+}
+
+func (s *MemoryTimerStore) remove(e Entry) {
+	if i := s.index(e); i >= 0 {
+		entries := s.entries[e.TicketID]
+		s.replace(e.TicketID, append(entries[:i:i], entries[i+1:]...))
+	}
+}
+
+func (s *MemoryTimerStore) Update(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update(e)
+	return nil
+}
+
+func (s *MemoryTimerStore) update(e Entry) {
+	if i := s.index(e); i >= 0 {
+		s.entries[e.TicketID][i] = e
+	}
+}
+
+// index 返回 e 在所属工单定时器中的位置，不存在时返回 -1。
+// 同一定时器重新调度后 EnteredAt 不同，不能被旧条目删除或修改。
+func (s *MemoryTimerStore) index(e Entry) int {
+	for i, cur := range s.entries[e.TicketID] {
+		if cur.key() == e.key() && cur.EnteredAt.Equal(e.EnteredAt) {
+			return i
+		}
+	}
+	return -1
+}
+
+// FileTimerStore 将定时器保存在 JSON 文件中，重启后通过 OpenFileTimerStore 恢复
+type FileTimerStore struct {
+	mem  *MemoryTimerStore
+	path string
+}
+
+// OpenFileTimerStore 打开或创建定时器文件
+func OpenFileTimerStore(path string) (*FileTimerStore, error) {
+	s := &FileTimerStore{mem: NewMemoryTimerStore(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		s.mem.entries[e.TicketID] = append(s.mem.entries[e.TicketID], e)
+	}
+	return s, nil
+}
+
+func (s *FileTimerStore) Replace(ctx context.Context, ticketID string, entries []Entry) error {
+	return s.apply(ticketID, func() { s.mem.replace(ticketID, entries) })
+}
+
+func (s *FileTimerStore) Due(ctx context.Context, now time.Time) ([]Entry, error) {
+	return s.mem.Due(ctx, now)
+}
+
+func (s *FileTimerStore) Remove(ctx context.Context, e Entry) error {
+	return s.apply(e.TicketID, func() { s.mem.remove(e) })
+}
+
+func (s *FileTimerStore) Update(ctx context.Context, e Entry) error {
+	return s.apply(e.TicketID, func() { s.mem.update(e) })
+}
+
+// apply 在内存中执行 change 后写入文件。change 只修改工单 ticketID 的定时器，
+// 写入失败时恢复它们，内存中的内容始终与文件一致
+func (s *FileTimerStore) apply(ticketID string, change func()) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	prev, ok := s.mem.entries[ticketID]
+	prev = slices.Clone(prev)
+	change()
+	if err := s.flush(); err != nil {
+		if ok {
+			s.mem.entries[ticketID] = prev
+		} else {
+			delete(s.mem.entries, ticketID)
+		}
+		return err
+	}
+	return nil
+}
+
+// flush 先写临时文件再重命名，保证文件要么是旧内容要么是新内容
+func (s *FileTimerStore) flush() error {
+	all := make([]Entry, 0, len(s.mem.entries))
+	for _, entries := range s.mem.entries {
+		all = append(all, entries...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].key() < all[j].key() })
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
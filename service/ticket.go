@@ -3,58 +3,281 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/rbac"
+	"github.com/kekexiaoai/ticket/scheduler"
 	"github.com/kekexiaoai/ticket/store"
 	"github.com/kekexiaoai/ticket/workflow"
 )
 
+// ErrAssigneeRequired Assign 与 Reassign 必须在 Payload.Assignee 中指定处理人
+var ErrAssigneeRequired = errors.New("assign and reassign require an explicit assignee")
+
+// ErrUnknownTicketType 工单类型没有对应的工作流
+var ErrUnknownTicketType = errors.New("unknown ticket type")
+
+// ErrReasonRequired 打回与拒绝必须在 Payload.Reason 中说明原因
+var ErrReasonRequired = errors.New("reason is required")
+
+// ErrReservedActor workflow.SystemActor 只用于定时器，不能通过公开接口以它的身份触发事件。
+// 它同时匹配 workflow.ErrForbidden
+var ErrReservedActor = fmt.Errorf("actor %s is reserved for timers: %w", workflow.SystemActor, workflow.ErrForbidden)
+
+// ErrTimersNotScheduled 工单已经保存，但调度定时器失败。工单已处于新状态，不应重试同一事件；
+// 缺失的定时器由 ReconcileTimers 补上
+var ErrTimersNotScheduled = errors.New("ticket saved but timers not scheduled")
+
+// DefaultWorkflow 与 DefaultVersion 为内置流程在 Registry 中的名称与版本，
+// 也用于未指定名称或版本的声明式定义
+const (
+	DefaultWorkflow = "ticket"
+	DefaultVersion  = "v1"
+)
+
 // TicketService 处理工单逻辑
 type TicketService struct {
-	sm    *workflow.StateMachine
-	store store.TicketStore
+	registry  *workflow.Registry
+	workflow  string            // 未设置类型的工单使用的工作流
+	types     map[string]string // 工单类型到工作流名称
+	store     store.TicketStore
+	policy    rbac.PolicyStore
+	scheduler *scheduler.Scheduler
+	approvals map[workflow.State]workflow.ApprovalSet
+	machines  map[*workflow.StateMachine]*workflow.StateMachine // Registry 中的状态机到服务持有的、注册了会签的副本
+	enforcer  *rbac.Enforcer
+	retries   int // 版本冲突时的重试次数
+	locks     [lockStripes]sync.Mutex
+}
+
+// DefaultConflictRetries 保存工单遇到版本冲突时默认的重试次数
+const DefaultConflictRetries = 3
+
+// lockStripes 工单锁的分段数，不同工单可能共用一个分段
+const lockStripes = 64
+
+// Option 配置 TicketService
+type Option func(*TicketService)
+
+// WithPolicy 使用指定的权限策略，默认为不含用户的 rbac.DefaultPolicy()
+func WithPolicy(policy rbac.PolicyStore) Option {
+	return func(ts *TicketService) {
+		ts.policy = policy
+	}
+}
+
+// WithScheduler 在创建工单与每次转换后为工单调度定时器，到期时由 FireTimer 触发。
+// 启动时应先调用 ReconcileTimers，再开始 Scheduler.Run
+func WithScheduler(s *scheduler.Scheduler) Option {
+	return func(ts *TicketService) {
+		ts.scheduler = s
+	}
+}
+
+// WithTicketType 将类型为 ticketType 的工单交给 Registry 中名为 workflowName 的工作流处理
+func WithTicketType(ticketType, workflowName string) Option {
+	return func(ts *TicketService) {
+		if ts.types == nil {
+			ts.types = make(map[string]string)
+		}
+		ts.types[ticketType] = workflowName
+	}
+}
+
+// WithConflictRetries 设置保存工单遇到版本冲突时的重试次数，默认为 DefaultConflictRetries，0 表示不重试
+func WithConflictRetries(n int) Option {
+	return func(ts *TicketService) {
+		ts.retries = n
+	}
+}
+
+// WithApprovals 将 state 设为会签状态，例如要求 FinalApproval 多方同意后才完成，
+// 应用于 Registry 中所有包含 state 的工作流版本。服务在这些状态机的副本上注册会签，Registry 中的状态机不被修改。
+// 审批组中的用户还需要在权限策略中被授予 set.Approve 与 set.Reject。
+func WithApprovals(state workflow.State, set workflow.ApprovalSet) Option {
+	return func(ts *TicketService) {
+		if ts.approvals == nil {
+			ts.approvals = make(map[workflow.State]workflow.ApprovalSet)
+		}
+		ts.approvals[state] = set
+	}
+}
+
+// NewStateMachine 返回注册了内置任务与定时器的默认流程状态机
+func NewStateMachine() *workflow.StateMachine {
+	sm := workflow.NewStateMachine()
+	registerTasks(sm)
+	return sm
 }
 
-func NewTicketService(store store.TicketStore) *TicketService {
-	ts := &TicketService{
-		sm:    workflow.NewStateMachine(),
-		store: store,
+func NewTicketService(store store.TicketStore, opts ...Option) *TicketService {
+	sm := NewStateMachine()
+	// 服务自己创建的状态机配置完成后冻结，转换可在 goroutine 间并发执行
+	sm.Freeze()
+	registry := workflow.NewRegistry()
+	if err := registry.Register(DefaultWorkflow, DefaultVersion, sm); err != nil {
+		panic(err)
+	}
+	ts, err := newTicketService(registry, DefaultWorkflow, store, opts)
+	if err != nil {
+		panic(err)
 	}
-	ts.registerTasks()
 	return ts
 }
 
+// NewTicketServiceFromDefinition 使用声明式工作流定义创建服务，定义中的任务名称从 Tasks() 中解析
+func NewTicketServiceFromDefinition(store store.TicketStore, def *workflow.Definition, opts ...Option) (*TicketService, error) {
+	sm, err := workflow.NewStateMachineFromDefinition(def, Tasks())
+	if err != nil {
+		return nil, err
+	}
+	sm.Freeze()
+	name, version := def.Name, def.Version
+	if name == "" {
+		name = DefaultWorkflow
+	}
+	if version == "" {
+		version = DefaultVersion
+	}
+	registry := workflow.NewRegistry()
+	if err := registry.Register(name, version, sm); err != nil {
+		return nil, err
+	}
+	return newTicketService(registry, name, store, opts)
+}
+
+// NewTicketServiceWithRegistry 使用 registry 中名为 name 的工作流创建服务。
+// 新工单使用最新版本，已有工单按 WorkflowVersion 使用创建时的版本；所有版本须在创建服务前注册。
+// 服务不修改也不冻结 registry 中的状态机，它们可以由多个服务共享；服务运行期间调用方不应再修改它们，
+// 例如由 workflow.Builder 构建或事先调用 Freeze。
+func NewTicketServiceWithRegistry(store store.TicketStore, registry *workflow.Registry, name string, opts ...Option) (*TicketService, error) {
+	if _, _, err := registry.Latest(name); err != nil {
+		return nil, err
+	}
+	return newTicketService(registry, name, store, opts)
+}
+
+func newTicketService(registry *workflow.Registry, name string, store store.TicketStore, opts []Option) (*TicketService, error) {
+	ts := &TicketService{registry: registry, workflow: name, store: store, retries: DefaultConflictRetries}
+	for _, opt := range opts {
+		opt(ts)
+	}
+	if ts.policy == nil {
+		ts.policy = rbac.DefaultPolicy()
+	}
+	for ticketType, name := range ts.types {
+		if _, _, err := registry.Latest(name); err != nil {
+			return nil, fmt.Errorf("ticket type %s: %w", ticketType, err)
+		}
+	}
+	ts.enforcer = rbac.NewEnforcer(ts.policy)
+	ts.machines = make(map[*workflow.StateMachine]*workflow.StateMachine)
+	err := registry.Each(func(name, version string, sm *workflow.StateMachine) error {
+		var c *workflow.StateMachine
+		for state, set := range ts.approvals {
+			if !sm.HasState(state) {
+				continue
+			}
+			if c == nil {
+				c = sm.Clone()
+			}
+			if err := c.RegisterApprovals(state, set); err != nil {
+				return fmt.Errorf("workflow %s %s: %w", name, version, err)
+			}
+		}
+		if c != nil {
+			c.Freeze()
+			ts.machines[sm] = c
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// workflowOf 返回工单类型对应的工作流名称，类型为空时使用默认工作流
+func (ts *TicketService) workflowOf(ticketType string) (string, error) {
+	if ticketType == "" {
+		return ts.workflow, nil
+	}
+	name, ok := ts.types[ticketType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTicketType, ticketType)
+	}
+	return name, nil
+}
+
+// machine 返回工单类型对应的工作流中，工单所固定版本的状态机，使用服务的权限策略与会签规则。
+// Registry 中的状态机本身不被修改，可以由多个服务共享
+func (ts *TicketService) machine(ticket *model.Ticket) (*workflow.StateMachine, error) {
+	name, err := ts.workflowOf(ticket.Type)
+	if err != nil {
+		return nil, err
+	}
+	sm, err := ts.registry.Get(name, ticket.WorkflowVersion)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := ts.machines[sm]; ok {
+		sm = c
+	}
+	return sm.WithAuthorizer(ts.enforcer), nil
+}
+
+// Tasks 返回服务内置的任务，供声明式工作流定义按名称引用
+func Tasks() workflow.TaskRegistry {
+	return workflow.NewTaskRegistry(
+		notifyAssign,
+		onExitPending,
+		notifyApproveInitial,
+		notifyRejectInitial,
+		onEnterInProgress,
+		checkInProgress,
+		logReassign,
+		updatePriority,
+		requireReason,
+		escalate,
+		notifyFinalApproval,
+	)
+}
+
 // 定义任务工厂
 var (
 	// Pending 任务
 	notifyAssign = workflow.Task{
 		Name: "NotifyAssign",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventAssign {
-				log.Printf("通知: 工单 %s 被审批人 %s 领取", ticket.ID, ticket.AssigneeID)
-			}
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			log.Printf("通知: 工单 %s 被审批人 %s 领取", ticket.ID, ticket.AssigneeID)
 			return nil
 		},
 	}
 	onExitPending = workflow.Task{
 		Name: "OnExitPending",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
 			log.Printf("退出 Pending: 工单 %s 被领取或取消", ticket.ID)
 			return nil
 		},
 	}
 
 	// InitialReview 任务
-	notifyInitialReview = workflow.Task{
-		Name: "NotifyInitialReview",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventApproveInitial {
-				log.Printf("通知: 工单 %s 初审通过，进入处理流程", ticket.ID)
-			} else if event == workflow.EventRejectInitial {
-				log.Printf("通知: 工单 %s 初审被打回，需补充材料", ticket.ID)
-			}
+	notifyApproveInitial = workflow.Task{
+		Name: "NotifyApproveInitial",
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			log.Printf("通知: 工单 %s 初审通过，进入处理流程", ticket.ID)
+			return nil
+		},
+	}
+	notifyRejectInitial = workflow.Task{
+		Name: "NotifyRejectInitial",
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			log.Printf("通知: 工单 %s 初审被打回，需补充材料: %s", ticket.ID, payload.Reason)
 			return nil
 		},
 	}
@@ -62,82 +285,302 @@ var (
 	// InProgress 任务
 	onEnterInProgress = workflow.Task{
 		Name: "OnEnterInProgress",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
 			log.Printf("进入 InProgress: 工单 %s 开始处理", ticket.ID)
 			return nil
 		},
 	}
 	checkInProgress = workflow.Task{
 		Name: "CheckInProgress",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
 			log.Printf("检查: 工单 %s 在 InProgress 执行 %s", ticket.ID, event)
 			return nil
 		},
 	}
 	logReassign = workflow.Task{
 		Name: "LogReassign",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventReassign {
-				log.Printf("日志: 工单 %s 被转交给 %s", ticket.ID, ticket.AssigneeID)
-			}
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			log.Printf("日志: 工单 %s 被转交给 %s", ticket.ID, ticket.AssigneeID)
 			return nil
 		},
 	}
-	// InProgress 任务
+	// 优先级 = 初始优先级 + 转交次数，在 Reassign 与 Resume 时重新计算
 	updatePriority = workflow.Task{
 		Name: "UpdatePriority",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventReassign || event == workflow.EventResume {
-				newPriority := ticket.InitialPriority + ticket.ReassignCount
-				if newPriority != ticket.Priority {
-					ticket.Priority = newPriority
-					log.Printf("任务: 工单 %s 优先级更新为 %d (转交次数: %d)", ticket.ID, ticket.Priority, ticket.ReassignCount)
-				}
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			newPriority := ticket.InitialPriority + ticket.ReassignCount
+			if newPriority != ticket.Priority {
+				ticket.Priority = newPriority
+				log.Printf("任务: 工单 %s 优先级更新为 %d (转交次数: %d)", ticket.ID, ticket.Priority, ticket.ReassignCount)
 			}
 			return nil
 		},
 	}
 
-	// FinalApproval 任务
-	guardFinalApproval = workflow.Task{
-		Name: "GuardFinalApproval",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventApproveFinal && ticket.AssigneeID != "admin" {
-				return errors.New("只有管理员可以最终审批")
+	// 合规要求：打回与拒绝必须记录原因。试运行时没有 payload，因此跳过
+	requireReason = workflow.Task{
+		Name: "RequireReason",
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			if payload.Reason == "" && !workflow.IsDryRun(ctx) {
+				return ErrReasonRequired
 			}
 			return nil
 		},
 	}
+
+	escalate = workflow.Task{
+		Name: "Escalate",
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			ticket.Priority++
+			log.Printf("升级: 工单 %s 初审超时，优先级提升为 %d", ticket.ID, ticket.Priority)
+			return nil
+		},
+	}
+
+	// FinalApproval 任务
 	notifyFinalApproval = workflow.Task{
 		Name: "NotifyFinalApproval",
-		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event) error {
-			if event == workflow.EventApproveFinal {
-				log.Printf("通知: 工单 %s 最终审批通过", ticket.ID)
-			}
+		Execute: func(ctx context.Context, ticket *model.Ticket, event workflow.Event, payload model.Payload) error {
+			log.Printf("通知: 工单 %s 最终审批通过", ticket.ID)
 			return nil
 		},
 	}
 )
 
-func (ts *TicketService) registerTasks() {
-	ts.sm.RegisterTasks(workflow.StatePending, nil, []workflow.Task{notifyAssign}, nil, []workflow.Task{onExitPending}, nil)
-	ts.sm.RegisterTasks(workflow.StateInitialReview, nil, []workflow.Task{notifyInitialReview}, nil, nil, nil)
-	ts.sm.RegisterTasks(workflow.StateInProgress, []workflow.Task{checkInProgress}, []workflow.Task{logReassign, updatePriority}, []workflow.Task{onEnterInProgress}, nil, nil)
-	ts.sm.RegisterTasks(workflow.StateFinalApproval, nil, []workflow.Task{notifyFinalApproval}, nil, nil, []workflow.Task{guardFinalApproval})
+func registerTasks(sm *workflow.StateMachine) {
+	sm.RegisterTasks(workflow.StatePending, nil, nil, nil, []workflow.Task{onExitPending}, nil)
+	sm.RegisterTasks(workflow.StateInProgress, []workflow.Task{checkInProgress}, nil, []workflow.Task{onEnterInProgress}, nil, nil)
+	sm.RegisterTimers(workflow.StatePending, workflow.Timer{Name: "AutoCancel", After: 14 * 24 * time.Hour, Event: workflow.EventCancel})
+	sm.RegisterTimers(workflow.StateInitialReview, workflow.Timer{Name: "EscalateReview", After: 4 * time.Hour, Event: workflow.EventEscalate})
+
+	edges := []struct {
+		from    workflow.State
+		event   workflow.Event
+		guards  []workflow.Task
+		actions []workflow.Task
+	}{
+		{workflow.StatePending, workflow.EventAssign, nil, []workflow.Task{notifyAssign}},
+		{workflow.StateInitialReview, workflow.EventApproveInitial, nil, []workflow.Task{notifyApproveInitial}},
+		{workflow.StateInitialReview, workflow.EventRejectInitial, []workflow.Task{requireReason}, []workflow.Task{notifyRejectInitial}},
+		{workflow.StateInitialReview, workflow.EventDenyInitial, []workflow.Task{requireReason}, nil},
+		{workflow.StateInitialReview, workflow.EventEscalate, nil, []workflow.Task{escalate}},
+		{workflow.StateWorking, workflow.EventReassign, nil, []workflow.Task{logReassign, updatePriority}},
+		{workflow.StateOnHold, workflow.EventResume, nil, []workflow.Task{updatePriority}},
+		{workflow.StateFinalApproval, workflow.EventApproveFinal, nil, []workflow.Task{notifyFinalApproval}},
+		{workflow.StateFinalApproval, workflow.EventRejectFinal, []workflow.Task{requireReason}, nil},
+	}
+	for _, e := range edges {
+		if err := sm.RegisterTransitionTasks(e.from, e.event, e.guards, e.actions); err != nil {
+			panic(err)
+		}
+	}
 }
 
-func (ts *TicketService) TransitionTicket(ctx context.Context, ticketID string, event workflow.Event, triggeredBy string) error {
-	ticket, err := ts.store.GetTicket(ctx, ticketID)
+// TransitionTicket 由 actor 对工单触发不带数据的事件，等同于 payload 为空的 TransitionTicketWithPayload
+func (ts *TicketService) TransitionTicket(ctx context.Context, ticketID string, event workflow.Event, actor string) error {
+	return ts.TransitionTicketWithPayload(ctx, ticketID, event, actor, model.Payload{})
+}
+
+// TransitionTicketWithPayload 由 actor 对工单触发事件并保存，payload 传入任务并记录在历史中。
+// Assign 与 Reassign 必须指定 payload.Assignee，其他事件不改变处理人。返回的错误可用 errors.Is 区分：
+// ErrReservedActor、store.ErrTicketNotFound、ErrUnknownTicketType、workflow.ErrUnknownWorkflow、workflow.ErrInvalidTransition、workflow.ErrForbidden、workflow.ErrGuardRejected、workflow.ErrTaskFailed，
+// 版本冲突重试用尽后返回 store.ErrVersionConflict；转换已保存但调度定时器失败时返回 ErrTimersNotScheduled。
+func (ts *TicketService) TransitionTicketWithPayload(ctx context.Context, ticketID string, event workflow.Event, actor string, payload model.Payload) error {
+	if actor == workflow.SystemActor {
+		return ErrReservedActor
+	}
+	isAssign := event == workflow.EventAssign || event == workflow.EventReassign
+	if isAssign && payload.Assignee == "" {
+		return ErrAssigneeRequired
+	}
+	if !isAssign {
+		payload.Assignee = ""
+	}
+
+	defer ts.lock(ticketID)()
+	return ts.transition(ctx, ticketID, event, actor, payload, nil)
+}
+
+// transition 在持有工单锁时读取、转换并保存工单。skip 不为空且返回 true 时不做任何修改。
+// 工单在读取后被其他服务实例修改时重新读取并转换，最多重试 ts.retries 次，任务可能因此执行多次
+func (ts *TicketService) transition(ctx context.Context, ticketID string, event workflow.Event, actor string, payload model.Payload, skip func(*workflow.StateMachine, *model.Ticket) bool) error {
+	for attempt := 0; ; attempt++ {
+		err := ts.transitionOnce(ctx, ticketID, event, actor, payload, skip)
+		if !errors.Is(err, store.ErrVersionConflict) || attempt >= ts.retries {
+			return err
+		}
+		log.Printf("工单 %s 版本冲突，重试 %s (%d/%d)", ticketID, event, attempt+1, ts.retries)
+	}
+}
+
+func (ts *TicketService) transitionOnce(ctx context.Context, ticketID string, event workflow.Event, actor string, payload model.Payload, skip func(*workflow.StateMachine, *model.Ticket) bool) error {
+	var sm *workflow.StateMachine
+	var saved *model.Ticket
+	err := ts.update(ctx, ticketID, func(ticket *model.Ticket) error {
+		var err error
+		if sm, err = ts.machine(ticket); err != nil {
+			return err
+		}
+		if skip != nil && skip(sm, ticket) {
+			return errSkipped
+		}
+		if _, err := sm.Transition(ctx, ticket, event, actor, payload); err != nil {
+			return err
+		}
+		ticket.UpdatedAt = time.Now()
+		saved = ticket
+		return nil
+	})
+	if errors.Is(err, errSkipped) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	ticket.AssigneeID = triggeredBy
+	return ts.schedule(ctx, sm, saved)
+}
+
+// schedule 在工单保存后为其调度定时器，失败时返回包装了 ErrTimersNotScheduled 的错误
+func (ts *TicketService) schedule(ctx context.Context, sm *workflow.StateMachine, ticket *model.Ticket) error {
+	if ts.scheduler == nil {
+		return nil
+	}
+	if err := ts.scheduler.Schedule(ctx, sm, ticket); err != nil {
+		return fmt.Errorf("%w: ticket %s: %w", ErrTimersNotScheduled, ticket.ID, err)
+	}
+	return nil
+}
+
+// reconcileBatchSize ReconcileTimers 每次从存储读取的工单数
+const reconcileBatchSize = 500
+
+// ReconcileTimers 为所有未结束的工单重新调度定时器，补上工单保存后、调度定时器前进程退出而丢失的定时器。
+// 应在启动时、开始 Scheduler.Run 之前调用；单个工单失败不影响其他工单，错误汇总后返回
+func (ts *TicketService) ReconcileTimers(ctx context.Context) error {
+	if ts.scheduler == nil {
+		return nil
+	}
+	var errs []error
+	q := store.Query{Limit: reconcileBatchSize}
+	for {
+		page, err := ts.store.ListTickets(ctx, q)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for _, ticket := range page.Tickets {
+			if err := ts.reconcile(ctx, ticket.ID); err != nil {
+				errs = append(errs, fmt.Errorf("ticket %s: %w", ticket.ID, err))
+			}
+		}
+		if page.NextCursor == "" {
+			return errors.Join(errs...)
+		}
+		q.Cursor = page.NextCursor
+	}
+}
 
-	_, err = ts.sm.Transition(ctx, ticket, event)
+// reconcile 在持有工单锁时重新读取工单并调度定时器，列表中的工单可能已被并发的转换修改
+func (ts *TicketService) reconcile(ctx context.Context, ticketID string) error {
+	defer ts.lock(ticketID)()
+	ticket, err := ts.store.GetTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	sm, err := ts.machine(ticket)
 	if err != nil {
 		return err
 	}
+	if sm.IsTerminal(workflow.State(ticket.CurrentState)) {
+		return nil
+	}
+	return ts.scheduler.Schedule(ctx, sm, ticket)
+}
+
+// errSkipped 由 update 的回调返回，表示放弃修改且不是错误
+var errSkipped = errors.New("skipped")
 
-	ticket.UpdatedAt = time.Now()
+// update 读取工单，调用 fn 修改后保存。fn 返回错误时存储中的工单保持不变。
+// 存储实现 store.Updater 时在其事务中锁定工单，否则在副本上修改后依赖版本检查
+func (ts *TicketService) update(ctx context.Context, ticketID string, fn func(*model.Ticket) error) error {
+	if u, ok := ts.store.(store.Updater); ok {
+		return u.UpdateTicket(ctx, ticketID, fn)
+	}
+	stored, err := ts.store.GetTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	ticket := stored.Clone()
+	if err := fn(ticket); err != nil {
+		return err
+	}
 	return ts.store.SaveTicket(ctx, ticket)
 }
+
+// lock 锁住工单所在的分段并返回解锁函数，同一工单的读-改-写串行执行
+func (ts *TicketService) lock(ticketID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(ticketID))
+	mu := &ts.locks[h.Sum32()%lockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// FireTimer 以 workflow.SystemActor 身份触发到期的定时器，工单已离开定时器所在状态时忽略
+func (ts *TicketService) FireTimer(ctx context.Context, e scheduler.Entry) error {
+	defer ts.lock(e.TicketID)()
+	payload := model.Payload{Comment: "定时器 " + e.Timer}
+	return ts.transition(ctx, e.TicketID, e.Event, workflow.SystemActor, payload, func(sm *workflow.StateMachine, ticket *model.Ticket) bool {
+		if scheduler.IsStale(sm, ticket, e) {
+			return true
+		}
+		log.Printf("定时器: 工单 %s 在 %s 触发 %s (%s)", e.TicketID, e.State, e.Event, e.Timer)
+		return false
+	})
+}
+
+// AssignTicket 由 actor 将待领取的工单分配给 assignee（审批人领取时两者相同）
+func (ts *TicketService) AssignTicket(ctx context.Context, ticketID, actor, assignee string) error {
+	return ts.TransitionTicketWithPayload(ctx, ticketID, workflow.EventAssign, actor, model.Payload{Assignee: assignee})
+}
+
+// ReassignTicket 由 actor 将处理中的工单转交给 assignee
+func (ts *TicketService) ReassignTicket(ctx context.Context, ticketID, actor, assignee string) error {
+	return ts.TransitionTicketWithPayload(ctx, ticketID, workflow.EventReassign, actor, model.Payload{Assignee: assignee})
+}
+
+// AvailableEvents 返回 actor 当前可以对工单触发的事件，供前端渲染可用操作
+func (ts *TicketService) AvailableEvents(ctx context.Context, ticketID string, actor string) ([]workflow.Event, error) {
+	ticket, err := ts.store.GetTicket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	sm, err := ts.machine(ticket)
+	if err != nil {
+		return nil, err
+	}
+	return sm.AvailableEvents(ctx, ticket, actor), nil
+}
+
+// CreateTicket 以工单类型对应工作流的最新版本创建工单：校验类型，设置初始状态、WorkflowVersion 与创建时间后保存，
+// 并调度初始状态的定时器
+func (ts *TicketService) CreateTicket(ctx context.Context, ticket *model.Ticket) error {
+	name, err := ts.workflowOf(ticket.Type)
+	if err != nil {
+		return err
+	}
+	version, sm, err := ts.registry.Latest(name)
+	if err != nil {
+		return err
+	}
+	ticket.CurrentState = string(sm.InitialState())
+	ticket.WorkflowVersion = version
+	if ticket.CreatedAt.IsZero() {
+		ticket.CreatedAt = time.Now()
+	}
+	ticket.UpdatedAt = ticket.CreatedAt
+	defer ts.lock(ticket.ID)()
+	if err := ts.store.SaveTicket(ctx, ticket); err != nil {
+		return err
+	}
+	return ts.schedule(ctx, sm, ticket)
+}
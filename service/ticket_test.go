@@ -2,17 +2,32 @@ package service
 
 import (
 	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/rbac"
+	"github.com/kekexiaoai/ticket/scheduler"
 	"github.com/kekexiaoai/ticket/store"
 	"github.com/kekexiaoai/ticket/workflow"
 )
 
+// newTestPolicy 返回测试用的权限策略：user456 为审批人，admin 为管理员
+func newTestPolicy() *rbac.MemoryPolicyStore {
+	policy := rbac.DefaultPolicy()
+	policy.AddUser("user456", rbac.RoleApprover)
+	policy.AddUser("admin", rbac.RoleAdmin)
+	return policy
+}
+
 func TestTicketService_TransitionTicket(t *testing.T) {
 	store := store.NewMockStore()
-	ts := NewTicketService(store)
+	ts := NewTicketService(store, WithPolicy(newTestPolicy()))
 
 	// 初始化工单
 	ticket := &model.Ticket{
@@ -28,25 +43,32 @@ func TestTicketService_TransitionTicket(t *testing.T) {
 	}
 
 	tests := []struct {
-		name        string
-		event       workflow.Event
-		triggeredBy string
-		wantState   string
-		wantErr     bool
+		name         string
+		event        workflow.Event
+		actor        string
+		assignee     string
+		wantState    string
+		wantAssignee string
+		wantErr      bool
 	}{
-		{"Submit", workflow.EventSubmit, "user123", string(workflow.StatePending), false},
-		{"Assign", workflow.EventAssign, "user456", string(workflow.StateInitialReview), false},
-		{"ApproveInitial", workflow.EventApproveInitial, "user456", string(workflow.StateInProgress), false},
-		{"Reassign", workflow.EventReassign, "user789", string(workflow.StateInProgress), false},
-		{"Invalid Event", workflow.EventCancel, "user789", string(workflow.StateInProgress), true},
-		{"FinalApproval with non-admin", workflow.EventSubmitFinal, "user789", string(workflow.StateFinalApproval), false}, // 进入 FinalApproval
-		{"FinalApproval fail", workflow.EventApproveFinal, "user789", string(workflow.StateFinalApproval), true},           // Guard 阻止
-		{"FinalApproval success", workflow.EventApproveFinal, "admin", string(workflow.StateCompleted), false},             // Guard 通过
+		{"Submit", workflow.EventSubmit, "user123", "", string(workflow.StatePending), "", false},
+		{"Assign", workflow.EventAssign, "user456", "user456", string(workflow.StateInitialReview), "user456", false},
+		{"ApproveInitial", workflow.EventApproveInitial, "user456", "", string(workflow.StateWorking), "user456", false},
+		{"Reassign", workflow.EventReassign, "user456", "user789", string(workflow.StateWorking), "user789", false},
+		{"Invalid Event", workflow.EventCancel, "user789", "", string(workflow.StateWorking), "user789", true},
+		{"Hold", workflow.EventHold, "user789", "", string(workflow.StateOnHold), "user789", false},
+		{"Held ticket cannot SubmitFinal", workflow.EventSubmitFinal, "user789", "", string(workflow.StateOnHold), "user789", true},
+		{"Resume", workflow.EventResume, "user789", "", string(workflow.StateWorking), "user789", false},
+		{"SubmitFinal", workflow.EventSubmitFinal, "user789", "", string(workflow.StateSubmitted), "user789", false},
+		{"Assignee cannot ClaimFinal", workflow.EventClaimFinal, "user789", "", string(workflow.StateSubmitted), "user789", true},
+		{"ClaimFinal", workflow.EventClaimFinal, "admin", "", string(workflow.StateFinalApproval), "user789", false},            // 进入 FinalApproval
+		{"FinalApproval fail", workflow.EventApproveFinal, "user789", "", string(workflow.StateFinalApproval), "user789", true}, // 非管理员无权审批
+		{"FinalApproval success", workflow.EventApproveFinal, "admin", "", string(workflow.StateCompleted), "user789", false},   // 管理员审批，处理人不变
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ts.TransitionTicket(context.Background(), ticket.ID, tt.event, tt.triggeredBy)
+			err := fire(context.Background(), ts, ticket.ID, tt.event, tt.actor, tt.assignee)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TransitionTicket() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -56,14 +78,42 @@ func TestTicketService_TransitionTicket(t *testing.T) {
 				if updatedTicket.CurrentState != tt.wantState {
 					t.Errorf("Ticket.CurrentState = %v, want %v", updatedTicket.CurrentState, tt.wantState)
 				}
+				if updatedTicket.AssigneeID != tt.wantAssignee {
+					t.Errorf("Ticket.AssigneeID = %v, want %v", updatedTicket.AssigneeID, tt.wantAssignee)
+				}
+				if last := updatedTicket.History[len(updatedTicket.History)-1]; last.TriggeredBy != tt.actor {
+					t.Errorf("History.TriggeredBy = %v, want %v", last.TriggeredBy, tt.actor)
+				}
 			}
 		})
 	}
 }
 
+// fire 按事件选择服务方法，Assign 与 Reassign 需要指定处理人
+func fire(ctx context.Context, ts *TicketService, ticketID string, event workflow.Event, actor, assignee string) error {
+	switch event {
+	case workflow.EventAssign:
+		return ts.AssignTicket(ctx, ticketID, actor, assignee)
+	case workflow.EventReassign:
+		return ts.ReassignTicket(ctx, ticketID, actor, assignee)
+	}
+	return ts.TransitionTicket(ctx, ticketID, event, actor)
+}
+
+func TestTicketService_AssigneeRequired(t *testing.T) {
+	ts := NewTicketService(store.NewMockStore(), WithPolicy(newTestPolicy()))
+	ctx := context.Background()
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventReassign, "user456"); !errors.Is(err, ErrAssigneeRequired) {
+		t.Errorf("TransitionTicket(Reassign) error = %v, want ErrAssigneeRequired", err)
+	}
+	if err := ts.AssignTicket(ctx, "test-ticket", "user456", ""); !errors.Is(err, ErrAssigneeRequired) {
+		t.Errorf("AssignTicket() error = %v, want ErrAssigneeRequired", err)
+	}
+}
+
 func TestTicketService_InProgressPriorityTask(t *testing.T) {
 	store := store.NewMockStore()
-	ts := NewTicketService(store)
+	ts := NewTicketService(store, WithPolicy(newTestPolicy()))
 
 	ticket := &model.Ticket{
 		ID:              "test-ticket",
@@ -80,11 +130,11 @@ func TestTicketService_InProgressPriorityTask(t *testing.T) {
 
 	ctx := context.Background()
 	ts.TransitionTicket(ctx, ticket.ID, workflow.EventSubmit, "user123")
-	ts.TransitionTicket(ctx, ticket.ID, workflow.EventAssign, "user456")
+	ts.AssignTicket(ctx, ticket.ID, "user456", "user456")
 	ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveInitial, "user456")
 
 	// 第一次 Reassign
-	ts.TransitionTicket(ctx, ticket.ID, workflow.EventReassign, "user789")
+	ts.ReassignTicket(ctx, ticket.ID, "user456", "user789")
 	updatedTicket, _ := store.GetTicket(ctx, ticket.ID)
 	if updatedTicket.ReassignCount != 1 {
 		t.Errorf("ReassignCount = %d, want 1", updatedTicket.ReassignCount)
@@ -94,7 +144,7 @@ func TestTicketService_InProgressPriorityTask(t *testing.T) {
 	}
 
 	// 第二次 Reassign
-	ts.TransitionTicket(ctx, ticket.ID, workflow.EventReassign, "user999")
+	ts.ReassignTicket(ctx, ticket.ID, "user789", "user999")
 	updatedTicket, _ = store.GetTicket(ctx, ticket.ID)
 	if updatedTicket.ReassignCount != 2 {
 		t.Errorf("ReassignCount = %d, want 2", updatedTicket.ReassignCount)
@@ -106,7 +156,7 @@ func TestTicketService_InProgressPriorityTask(t *testing.T) {
 
 func TestTicketService_PendingOnExit(t *testing.T) {
 	store := store.NewMockStore()
-	ts := NewTicketService(store)
+	ts := NewTicketService(store, WithPolicy(newTestPolicy()))
 
 	ticket := &model.Ticket{
 		ID:           "test-ticket",
@@ -122,7 +172,7 @@ func TestTicketService_PendingOnExit(t *testing.T) {
 
 	ctx := context.Background()
 	ts.TransitionTicket(ctx, ticket.ID, workflow.EventSubmit, "user123")
-	ts.TransitionTicket(ctx, ticket.ID, workflow.EventAssign, "user456")
+	ts.AssignTicket(ctx, ticket.ID, "user456", "user456")
 
 	updatedTicket, _ := store.GetTicket(ctx, ticket.ID)
 	if updatedTicket.CurrentState != string(workflow.StateInitialReview) {
@@ -130,3 +180,904 @@ func TestTicketService_PendingOnExit(t *testing.T) {
 	}
 	// OnExitPending 的效果通过日志验证（这里假设日志已记录）
 }
+
+func TestNewTicketServiceFromDefinition(t *testing.T) {
+	def, err := workflow.LoadDefinition("testdata/workflow.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := store.NewMockStore()
+	ts, err := NewTicketServiceFromDefinition(store, def, WithPolicy(newTestPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket := &model.Ticket{
+		ID:              "test-ticket",
+		Title:           "Test Ticket",
+		Priority:        1,
+		InitialPriority: 1,
+		CurrentState:    string(workflow.StateNew),
+		CreatorID:       "user123",
+		CreatedAt:       time.Now(),
+	}
+	if err := store.SaveTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	steps := []struct {
+		event    workflow.Event
+		actor    string
+		assignee string
+	}{
+		{workflow.EventSubmit, "user123", ""},
+		{workflow.EventAssign, "user456", "user456"},
+		{workflow.EventApproveInitial, "user456", ""},
+		{workflow.EventReassign, "user456", "user789"},
+		{workflow.EventSubmitFinal, "user789", ""},
+		{workflow.EventClaimFinal, "admin", ""},
+	}
+	for _, step := range steps {
+		if err := fire(ctx, ts, ticket.ID, step.event, step.actor, step.assignee); err != nil {
+			t.Fatalf("TransitionTicket(%s) error = %v", step.event, err)
+		}
+	}
+	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveFinal, "user789"); err == nil {
+		t.Error("Expected non-admin ApproveFinal to be forbidden, got nil")
+	}
+	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveFinal, "admin"); err != nil {
+		t.Fatalf("TransitionTicket(ApproveFinal) error = %v", err)
+	}
+
+	updatedTicket, _ := store.GetTicket(ctx, ticket.ID)
+	if updatedTicket.CurrentState != string(workflow.StateCompleted) {
+		t.Errorf("Ticket.CurrentState = %v, want %v", updatedTicket.CurrentState, workflow.StateCompleted)
+	}
+	if updatedTicket.Priority != 2 {
+		t.Errorf("Priority = %d, want 2 after one Reassign", updatedTicket.Priority)
+	}
+}
+
+func TestTicketService_FailedTransitionLeavesStoreUntouched(t *testing.T) {
+	store := store.NewMockStore()
+	ts := NewTicketService(store, WithPolicy(newTestPolicy()))
+
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		Title:        "Test Ticket",
+		Priority:     1,
+		CurrentState: string(workflow.StateFinalApproval),
+		AssigneeID:   "user789",
+		CreatorID:    "user123",
+		CreatedAt:    time.Now(),
+	}
+	if err := store.SaveTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventApproveFinal, "user000"); err == nil {
+		t.Fatal("Expected non-admin ApproveFinal to be forbidden, got nil")
+	}
+	updatedTicket, _ := store.GetTicket(ctx, ticket.ID)
+	if updatedTicket.AssigneeID != "user789" {
+		t.Errorf("AssigneeID = %v, want user789", updatedTicket.AssigneeID)
+	}
+	if updatedTicket.CurrentState != string(workflow.StateFinalApproval) || len(updatedTicket.History) != 0 {
+		t.Errorf("stored ticket was modified by a failed transition: %+v", updatedTicket)
+	}
+}
+
+func TestTicketService_AvailableEvents(t *testing.T) {
+	store := store.NewMockStore()
+	ts := NewTicketService(store, WithPolicy(newTestPolicy()))
+
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		Title:        "Test Ticket",
+		CurrentState: string(workflow.StateFinalApproval),
+		AssigneeID:   "user789",
+		CreatorID:    "user123",
+		CreatedAt:    time.Now(),
+	}
+	if err := store.SaveTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		actor string
+		want  []workflow.Event
+	}{
+		{"admin", []workflow.Event{workflow.EventApproveFinal, workflow.EventRejectFinal}},
+		{"user789", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.actor, func(t *testing.T) {
+			got, err := ts.AvailableEvents(context.Background(), ticket.ID, tt.actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AvailableEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ts.AvailableEvents(context.Background(), "missing", "admin"); err == nil {
+		t.Error("Expected error for missing ticket, got nil")
+	}
+}
+
+func TestTicketService_TransitionTicketErrors(t *testing.T) {
+	mockStore := store.NewMockStore()
+	ts := NewTicketService(mockStore, WithPolicy(newTestPolicy()))
+
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		Title:        "Test Ticket",
+		CurrentState: string(workflow.StateFinalApproval),
+		CreatorID:    "user123",
+		CreatedAt:    time.Now(),
+	}
+	if err := mockStore.SaveTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ticketID string
+		event    workflow.Event
+		actor    string
+		want     []error
+	}{
+		{"not found", "missing", workflow.EventApproveFinal, "admin", []error{store.ErrTicketNotFound}},
+		{"invalid transition", ticket.ID, workflow.EventSubmit, "admin", []error{workflow.ErrInvalidTransition}},
+		{"forbidden", ticket.ID, workflow.EventApproveFinal, "user789", []error{workflow.ErrForbidden, rbac.ErrPermissionDenied}},
+		{"guard rejected", ticket.ID, workflow.EventRejectFinal, "admin", []error{workflow.ErrGuardRejected, ErrReasonRequired}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ts.TransitionTicket(context.Background(), tt.ticketID, tt.event, tt.actor)
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("TransitionTicket() error = %v, want errors.Is %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTicketService_ReasonRequired(t *testing.T) {
+	mockStore := store.NewMockStore()
+	ts := NewTicketService(mockStore, WithPolicy(newTestPolicy()))
+
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		Title:        "Test Ticket",
+		CurrentState: string(workflow.StateFinalApproval),
+		AssigneeID:   "user789",
+		CreatorID:    "user123",
+		CreatedAt:    time.Now(),
+	}
+	if err := mockStore.SaveTicket(context.Background(), ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := ts.TransitionTicket(ctx, ticket.ID, workflow.EventRejectFinal, "admin"); !errors.Is(err, ErrReasonRequired) {
+		t.Fatalf("TransitionTicket(RejectFinal) error = %v, want ErrReasonRequired", err)
+	}
+	payload := model.Payload{Reason: "缺少回滚方案"}
+	if err := ts.TransitionTicketWithPayload(ctx, ticket.ID, workflow.EventRejectFinal, "admin", payload); err != nil {
+		t.Fatalf("TransitionTicketWithPayload(RejectFinal) error = %v", err)
+	}
+
+	updatedTicket, _ := mockStore.GetTicket(ctx, ticket.ID)
+	if updatedTicket.CurrentState != string(workflow.StateWorking) {
+		t.Errorf("Ticket.CurrentState = %v, want %v", updatedTicket.CurrentState, workflow.StateWorking)
+	}
+	if last := updatedTicket.History[len(updatedTicket.History)-1]; last.Payload.Reason != payload.Reason {
+		t.Errorf("History.Payload.Reason = %q, want %q", last.Payload.Reason, payload.Reason)
+	}
+}
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestTicketService_Timers(t *testing.T) {
+	mockStore := store.NewMockStore()
+	clock := &fakeClock{now: time.Now()}
+	sched := scheduler.New(scheduler.NewMemoryTimerStore(), clock)
+	ts := NewTicketService(mockStore, WithPolicy(newTestPolicy()), WithScheduler(sched))
+
+	ctx := context.Background()
+	for _, id := range []string{"stale-ticket", "review-ticket"} {
+		ticket := &model.Ticket{
+			ID:           id,
+			Title:        "Test Ticket",
+			Priority:     1,
+			CurrentState: string(workflow.StateNew),
+			CreatorID:    "user123",
+			CreatedAt:    time.Now(),
+		}
+		if err := mockStore.SaveTicket(ctx, ticket); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.TransitionTicket(ctx, id, workflow.EventSubmit, "user123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.AssignTicket(ctx, "review-ticket", "user456", "user456"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 初审 4 小时未处理，升级一次
+	clock.now = clock.now.Add(5 * time.Hour)
+	if n, err := sched.RunDue(ctx, ts); n != 1 || err != nil {
+		t.Fatalf("RunDue() = %d, %v, want 1, nil", n, err)
+	}
+	reviewed, _ := mockStore.GetTicket(ctx, "review-ticket")
+	if reviewed.CurrentState != string(workflow.StateInitialReview) || reviewed.Priority != 2 {
+		t.Errorf("review-ticket = %s priority %d, want InitialReview priority 2", reviewed.CurrentState, reviewed.Priority)
+	}
+	if last := reviewed.History[len(reviewed.History)-1]; last.TriggeredBy != workflow.SystemActor || last.Event != string(workflow.EventEscalate) {
+		t.Errorf("last history = %+v, want Escalate by system", last)
+	}
+
+	// Pending 超过 14 天自动取消；升级后的初审工单进入审批，之前的定时器失效
+	if err := ts.TransitionTicket(ctx, "review-ticket", workflow.EventApproveInitial, "user456"); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(15 * 24 * time.Hour)
+	if n, err := sched.RunDue(ctx, ts); n != 1 || err != nil {
+		t.Fatalf("RunDue() = %d, %v, want 1, nil", n, err)
+	}
+	stale, _ := mockStore.GetTicket(ctx, "stale-ticket")
+	if stale.CurrentState != string(workflow.StateCanceled) {
+		t.Errorf("stale-ticket state = %s, want Canceled", stale.CurrentState)
+	}
+	reviewed, _ = mockStore.GetTicket(ctx, "review-ticket")
+	if reviewed.CurrentState != string(workflow.StateWorking) {
+		t.Errorf("review-ticket state = %s, want Working", reviewed.CurrentState)
+	}
+}
+
+// failingTimerStore 在 fail 为 true 时拒绝替换定时器
+type failingTimerStore struct {
+	*scheduler.MemoryTimerStore
+	fail bool
+}
+
+var errTimerStore = errors.New("timer store unavailable")
+
+func (s *failingTimerStore) Replace(ctx context.Context, ticketID string, entries []scheduler.Entry) error {
+	if s.fail {
+		return errTimerStore
+	}
+	return s.MemoryTimerStore.Replace(ctx, ticketID, entries)
+}
+
+func TestTicketService_TimerScheduling(t *testing.T) {
+	access := workflow.NewBuilder().
+		State("Requested").On("Grant").GoTo("Granted").On("Expire").GoTo("Expired").
+		Timer("Expire", 24*time.Hour, "Expire").
+		State("Granted").Terminal().
+		State("Expired").Terminal().
+		MustBuild()
+	registry := workflow.NewRegistry()
+	if err := registry.Register("access", "v1", access); err != nil {
+		t.Fatal(err)
+	}
+	policy := rbac.NewMemoryPolicyStore()
+	policy.AddUser("security", "security")
+	policy.Grant("security", "Requested", "Grant")
+	policy.Grant(rbac.RoleSystem, "Requested", "Expire")
+
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	timers := &failingTimerStore{MemoryTimerStore: scheduler.NewMemoryTimerStore()}
+	sched := scheduler.New(timers, clock)
+	mockStore := store.NewMockStore()
+	ts, err := NewTicketServiceWithRegistry(mockStore, registry, "access", WithPolicy(policy), WithScheduler(sched))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 创建工单时调度初始状态的定时器
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "created", CreatorID: "user123", CreatedAt: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保存后调度失败：工单已处于新状态，错误与转换失败区分开
+	timers.fail = true
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "unscheduled", CreatorID: "user123", CreatedAt: start}); !errors.Is(err, ErrTimersNotScheduled) || !errors.Is(err, errTimerStore) {
+		t.Fatalf("CreateTicket() with a failing timer store error = %v, want ErrTimersNotScheduled", err)
+	}
+	if err := ts.TransitionTicket(ctx, "created", "Grant", "security"); !errors.Is(err, ErrTimersNotScheduled) {
+		t.Fatalf("Grant with a failing timer store error = %v, want ErrTimersNotScheduled", err)
+	}
+	if got, _ := mockStore.GetTicket(ctx, "created"); got.CurrentState != "Granted" {
+		t.Errorf("created state = %s, want Granted", got.CurrentState)
+	}
+	timers.fail = false
+
+	// 绕过服务保存的工单（例如保存后、调度前进程退出）在启动时补上定时器，已结束的工单被跳过
+	for _, ticket := range []*model.Ticket{
+		{ID: "imported", CurrentState: "Requested", WorkflowVersion: "v1", CreatedAt: start},
+		{ID: "finished", CurrentState: "Granted", WorkflowVersion: "v1", CreatedAt: start},
+	} {
+		if err := mockStore.SaveTicket(ctx, ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.ReconcileTimers(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 公开接口不能冒充定时器触发只授予系统角色的事件
+	if err := ts.TransitionTicket(ctx, "imported", "Expire", workflow.SystemActor); !errors.Is(err, ErrReservedActor) || !errors.Is(err, workflow.ErrForbidden) {
+		t.Fatalf("Expire as %s error = %v, want ErrReservedActor", workflow.SystemActor, err)
+	}
+	if got, _ := mockStore.GetTicket(ctx, "imported"); got.CurrentState != "Requested" {
+		t.Fatalf("imported state = %s after a rejected system transition, want Requested", got.CurrentState)
+	}
+
+	// created 调度失败后留下的旧定时器已失效，触发时被忽略
+	clock.now = start.Add(25 * time.Hour)
+	if n, err := sched.RunDue(ctx, ts); n != 3 || err != nil {
+		t.Fatalf("RunDue() = %d, %v, want 3, nil", n, err)
+	}
+	for id, want := range map[string]string{"created": "Granted", "unscheduled": "Expired", "imported": "Expired", "finished": "Granted"} {
+		if got, _ := mockStore.GetTicket(ctx, id); got.CurrentState != want {
+			t.Errorf("%s state = %s, want %s", id, got.CurrentState, want)
+		}
+	}
+}
+
+// 会签的部分投票不离开状态，状态上的定时器照常触发
+func TestTicketService_VoteKeepsTimer(t *testing.T) {
+	review := workflow.NewBuilder().
+		State("Review").On("Approve").GoTo("Approved").On("Expire").GoTo("Expired").
+		Timer("SLA", 24*time.Hour, "Expire").
+		State("Approved").Terminal().
+		State("Expired").Terminal().
+		MustBuild()
+	registry := workflow.NewRegistry()
+	if err := registry.Register("review", "v1", review); err != nil {
+		t.Fatal(err)
+	}
+	policy := rbac.NewMemoryPolicyStore()
+	policy.AddUser("lead", "reviewer")
+	policy.AddUser("sre", "reviewer")
+	policy.Grant("reviewer", "Review", "Approve")
+	policy.Grant(rbac.RoleSystem, "Review", "Expire")
+
+	created := time.Now().Add(-2 * time.Hour)
+	clock := &fakeClock{now: created}
+	sched := scheduler.New(scheduler.NewMemoryTimerStore(), clock)
+	mockStore := store.NewMockStore()
+	ts, err := NewTicketServiceWithRegistry(mockStore, registry, "review", WithPolicy(policy), WithScheduler(sched),
+		WithApprovals("Review", workflow.ApprovalSet{Approve: "Approve", Groups: []workflow.ApprovalGroup{
+			{Name: "reviewers", Approvers: []string{"lead", "sre"}},
+		}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "test-ticket", CreatorID: "user123", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.TransitionTicket(ctx, "test-ticket", "Approve", "lead"); err != nil {
+		t.Fatal(err)
+	}
+	ticket, _ := mockStore.GetTicket(ctx, "test-ticket")
+	if at, ok := review.EnteredAt(ticket, "Review"); !ok || !at.Equal(created) {
+		t.Errorf("EnteredAt(Review) after a vote = %v, %v; want %v", at, ok, created)
+	}
+
+	clock.now = created.Add(25 * time.Hour)
+	if n, err := sched.RunDue(ctx, ts); n != 1 || err != nil {
+		t.Fatalf("RunDue() = %d, %v, want 1, nil", n, err)
+	}
+	if ticket, _ := mockStore.GetTicket(ctx, "test-ticket"); ticket.CurrentState != "Expired" {
+		t.Errorf("state = %s, want Expired", ticket.CurrentState)
+	}
+}
+
+func TestTicketService_Approvals(t *testing.T) {
+	policy := newTestPolicy()
+	policy.AddUser("lead", rbac.RoleApprover)
+	policy.AddUser("sre", rbac.RoleApprover)
+	policy.Grant(rbac.RoleApprover, workflow.StateFinalApproval, workflow.EventApproveFinal, workflow.EventRejectFinal)
+
+	mockStore := store.NewMockStore()
+	ts := NewTicketService(mockStore, WithPolicy(policy), WithApprovals(workflow.StateFinalApproval, workflow.ApprovalSet{
+		Approve: workflow.EventApproveFinal,
+		Reject:  workflow.EventRejectFinal,
+		Groups: []workflow.ApprovalGroup{
+			{Name: "lead", Approvers: []string{"lead"}},
+			{Name: "sre", Approvers: []string{"sre"}},
+		},
+	}))
+
+	ctx := context.Background()
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		Title:        "Test Ticket",
+		CurrentState: string(workflow.StateFinalApproval),
+		CreatorID:    "user123",
+		AssigneeID:   "user456",
+		CreatedAt:    time.Now(),
+	}
+	if err := mockStore.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventApproveFinal, "admin"); !errors.Is(err, workflow.ErrNotApprover) {
+		t.Errorf("admin vote error = %v, want ErrNotApprover", err)
+	}
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventApproveFinal, "lead"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := mockStore.GetTicket(ctx, "test-ticket")
+	if stored.CurrentState != string(workflow.StateFinalApproval) || len(stored.Approvals) != 1 {
+		t.Fatalf("after one vote: state %s, approvals %+v", stored.CurrentState, stored.Approvals)
+	}
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventApproveFinal, "sre"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ = mockStore.GetTicket(ctx, "test-ticket")
+	if stored.CurrentState != string(workflow.StateCompleted) {
+		t.Errorf("state = %s, want Completed after both groups approve", stored.CurrentState)
+	}
+}
+
+func TestTicketService_WorkflowVersions(t *testing.T) {
+	v1 := workflow.NewStateMachine()
+	registerTasks(v1)
+	// v2 领取后跳过初审直接开始处理
+	def, err := workflow.ParseDefinition([]byte(`
+name: ticket
+version: v2
+states:
+  - name: New
+  - name: Pending
+  - name: InProgress
+transitions:
+  - {from: New, event: Submit, to: Pending}
+  - {from: Pending, event: Assign, to: InProgress}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := workflow.NewRegistry()
+	if err := registry.Register(DefaultWorkflow, DefaultVersion, v1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RegisterDefinition(def, Tasks()); err != nil {
+		t.Fatal(err)
+	}
+
+	mockStore := store.NewMockStore()
+	ts, err := NewTicketServiceWithRegistry(mockStore, registry, DefaultWorkflow, WithPolicy(newTestPolicy()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, ticket := range []*model.Ticket{
+		{ID: "v1-ticket", CurrentState: string(workflow.StatePending), WorkflowVersion: "v1", CreatorID: "user123", CreatedAt: time.Now()},
+		{ID: "legacy-ticket", CurrentState: string(workflow.StatePending), CreatorID: "user123", CreatedAt: time.Now()},
+	} {
+		if err := mockStore.SaveTicket(ctx, ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	created := &model.Ticket{ID: "v2-ticket", Title: "Test Ticket", CreatorID: "user123"}
+	if err := ts.CreateTicket(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if created.WorkflowVersion != "v2" || created.CurrentState != string(workflow.StateNew) {
+		t.Fatalf("CreateTicket() = version %q state %q, want v2 New", created.WorkflowVersion, created.CurrentState)
+	}
+	if err := ts.TransitionTicket(ctx, "v2-ticket", workflow.EventSubmit, "user123"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]workflow.State{
+		"v1-ticket":     workflow.StateInitialReview,
+		"legacy-ticket": workflow.StateInitialReview,
+		"v2-ticket":     workflow.StateInProgress,
+	}
+	for id, state := range want {
+		if err := ts.AssignTicket(ctx, id, "user456", "user456"); err != nil {
+			t.Fatalf("AssignTicket(%s) error = %v", id, err)
+		}
+		got, _ := mockStore.GetTicket(ctx, id)
+		if got.CurrentState != string(state) {
+			t.Errorf("%s state = %s, want %s", id, got.CurrentState, state)
+		}
+	}
+
+	unknown := &model.Ticket{ID: "v9-ticket", CurrentState: string(workflow.StatePending), WorkflowVersion: "v9"}
+	if err := mockStore.SaveTicket(ctx, unknown); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.AssignTicket(ctx, "v9-ticket", "user456", "user456"); !errors.Is(err, workflow.ErrUnknownWorkflow) {
+		t.Errorf("AssignTicket(v9) error = %v, want ErrUnknownWorkflow", err)
+	}
+}
+
+func TestTicketService_TicketTypes(t *testing.T) {
+	registry := workflow.NewRegistry()
+	v1 := workflow.NewStateMachine()
+	registerTasks(v1)
+	if err := registry.Register(DefaultWorkflow, DefaultVersion, v1); err != nil {
+		t.Fatal(err)
+	}
+	def, err := workflow.LoadDefinition("testdata/incident.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RegisterDefinition(def, Tasks()); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := newTestPolicy()
+	policy.AddUser("oncall", "oncall")
+	policy.Grant("oncall", "Open", "Acknowledge")
+	policy.Grant("oncall", "Investigating", "Resolve")
+	policy.Grant(rbac.RoleCreator, "Resolved", "Close", "Reopen")
+
+	mockStore := store.NewMockStore()
+	ts, err := NewTicketServiceWithRegistry(mockStore, registry, DefaultWorkflow,
+		WithPolicy(policy),
+		WithTicketType("incident", "incident"),
+		WithTicketType("change", DefaultWorkflow),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	incident := &model.Ticket{ID: "incident-1", Type: "incident", Title: "数据库不可用", CreatorID: "user123"}
+	change := &model.Ticket{ID: "change-1", Type: "change", Title: "升级数据库", CreatorID: "user123"}
+	for _, ticket := range []*model.Ticket{incident, change} {
+		if err := ts.CreateTicket(ctx, ticket); err != nil {
+			t.Fatalf("CreateTicket(%s) error = %v", ticket.Type, err)
+		}
+	}
+	if incident.CurrentState != "Open" || change.CurrentState != string(workflow.StateNew) {
+		t.Errorf("initial states = %s, %s, want Open, New", incident.CurrentState, change.CurrentState)
+	}
+
+	for _, step := range []struct {
+		event workflow.Event
+		actor string
+	}{{"Acknowledge", "oncall"}, {"Resolve", "oncall"}, {"Close", "user123"}} {
+		if err := ts.TransitionTicket(ctx, "incident-1", step.event, step.actor); err != nil {
+			t.Fatalf("TransitionTicket(%s) error = %v", step.event, err)
+		}
+	}
+	got, _ := mockStore.GetTicket(ctx, "incident-1")
+	if got.CurrentState != "Closed" {
+		t.Errorf("incident state = %s, want Closed", got.CurrentState)
+	}
+	if err := ts.TransitionTicket(ctx, "change-1", "Acknowledge", "oncall"); !errors.Is(err, workflow.ErrInvalidTransition) {
+		t.Errorf("change Acknowledge error = %v, want ErrInvalidTransition", err)
+	}
+
+	unknown := &model.Ticket{ID: "access-1", Type: "access", CreatorID: "user123"}
+	if err := ts.CreateTicket(ctx, unknown); !errors.Is(err, ErrUnknownTicketType) {
+		t.Errorf("CreateTicket(access) error = %v, want ErrUnknownTicketType", err)
+	}
+	if _, err := mockStore.GetTicket(ctx, "access-1"); err == nil {
+		t.Error("ticket with unknown type was saved")
+	}
+
+	if _, err := NewTicketServiceWithRegistry(mockStore, registry, DefaultWorkflow, WithTicketType("access", "access")); !errors.Is(err, workflow.ErrUnknownWorkflow) {
+		t.Errorf("NewTicketServiceWithRegistry() with unknown workflow error = %v, want ErrUnknownWorkflow", err)
+	}
+}
+
+// doc/state.md 由 diagram 子命令生成，流程变更后需要重新生成
+func TestStateDiagramUpToDate(t *testing.T) {
+	doc, err := os.ReadFile("../doc/state.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := NewStateMachine().WriteDiagram(&b, workflow.FormatPlantUML, workflow.DiagramOptions{Guards: true, Tasks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(doc), b.String()) {
+		t.Error("doc/state.md is out of date, run: go run . diagram -format plantuml -guards -tasks")
+	}
+}
+
+func TestWorkflowsValidate(t *testing.T) {
+	if err := NewStateMachine().Validate(); err != nil {
+		t.Errorf("NewStateMachine().Validate() error = %v", err)
+	}
+	for _, path := range []string{"testdata/workflow.yaml", "testdata/incident.yaml"} {
+		def, err := workflow.LoadDefinition(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm, err := workflow.NewStateMachineFromDefinition(def, Tasks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.Validate(); err != nil {
+			t.Errorf("%s: Validate() error = %v", path, err)
+		}
+	}
+}
+
+func TestTicketService_FrozenWorkflow(t *testing.T) {
+	access := workflow.NewBuilder().
+		State("Requested").On("Grant").GoTo("Granted").On("Deny").GoTo("Denied").
+		State("Granted").Terminal().
+		State("Denied").Terminal().
+		MustBuild()
+	registry := workflow.NewRegistry()
+	if err := registry.Register("access", "v1", access); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := rbac.NewMemoryPolicyStore()
+	policy.AddUser("security", "security")
+	policy.Grant("security", "Requested", "Grant", "Deny")
+
+	// 两个服务共享同一个不可修改的状态机，各自使用自己的权限策略
+	mockStore := store.NewMockStore()
+	ts, err := NewTicketServiceWithRegistry(mockStore, registry, "access", WithPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewTicketServiceWithRegistry(mockStore, registry, "access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "access-1", CreatorID: "user123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.TransitionTicket(ctx, "access-1", "Grant", "security"); !errors.Is(err, workflow.ErrForbidden) {
+		t.Errorf("Grant with the default policy error = %v, want ErrForbidden", err)
+	}
+	if err := ts.TransitionTicket(ctx, "access-1", "Grant", "security"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := mockStore.GetTicket(ctx, "access-1")
+	if got.CurrentState != "Granted" {
+		t.Errorf("state = %s, want Granted", got.CurrentState)
+	}
+}
+
+// slowStore 读取后短暂停顿，使并发的读-改-写必然交错
+type slowStore struct {
+	*store.MockStore
+}
+
+func (s slowStore) GetTicket(ctx context.Context, id string) (*model.Ticket, error) {
+	ticket, err := s.MockStore.GetTicket(ctx, id)
+	time.Sleep(time.Millisecond)
+	return ticket, err
+}
+
+func TestTicketService_ConcurrentTransitions(t *testing.T) {
+	mockStore := store.NewMockStore()
+	ts := NewTicketService(slowStore{mockStore}, WithPolicy(newTestPolicy()))
+	ctx := context.Background()
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "test-ticket", Priority: 1, CreatorID: "user123"}); err != nil {
+		t.Fatal(err)
+	}
+	ts.TransitionTicket(ctx, "test-ticket", workflow.EventSubmit, "user123")
+	ts.AssignTicket(ctx, "test-ticket", "user456", "user456")
+	ts.TransitionTicket(ctx, "test-ticket", workflow.EventApproveInitial, "user456")
+
+	// 同一工单上的并发转换串行执行，不会丢失更新
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := ts.ReassignTicket(ctx, "test-ticket", "admin", "user789"); err != nil {
+				t.Errorf("ReassignTicket() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := ts.AvailableEvents(ctx, "test-ticket", "user456"); err != nil {
+				t.Errorf("AvailableEvents() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, _ := mockStore.GetTicket(ctx, "test-ticket")
+	if got.ReassignCount != n {
+		t.Errorf("ReassignCount = %d, want %d", got.ReassignCount, n)
+	}
+	if len(got.History) != 3+n {
+		t.Errorf("len(History) = %d, want %d", len(got.History), 3+n)
+	}
+	if got.CurrentState != string(workflow.StateWorking) {
+		t.Errorf("state = %s, want %s", got.CurrentState, workflow.StateWorking)
+	}
+}
+
+func TestTicketService_MachinesFrozen(t *testing.T) {
+	ts := NewTicketService(store.NewMockStore())
+	sm, err := ts.registry.Get(DefaultWorkflow, DefaultVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sm.Frozen() {
+		t.Fatal("machine is not frozen after NewTicketService")
+	}
+	if err := sm.RegisterTransitionTasks(workflow.StateNew, workflow.EventSubmit, nil, nil); !errors.Is(err, workflow.ErrFrozen) {
+		t.Errorf("RegisterTransitionTasks() error = %v, want ErrFrozen", err)
+	}
+}
+
+func TestTicketService_SharedRegistryApprovals(t *testing.T) {
+	review := workflow.NewBuilder().
+		State("Open").On("Approve").GoTo("Approved").On("Reject").GoTo("Rejected").
+		State("Approved").Terminal().
+		State("Rejected").Terminal().
+		MustBuild()
+	legacy := workflow.NewStateMachine()
+	registry := workflow.NewRegistry()
+	if err := registry.Register("review", "v1", review); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(DefaultWorkflow, DefaultVersion, legacy); err != nil {
+		t.Fatal(err)
+	}
+	policy := rbac.NewMemoryPolicyStore()
+	policy.AddUser("lead", "reviewer")
+	policy.AddUser("sre", "reviewer")
+	policy.Grant("reviewer", "Open", "Approve", "Reject")
+	approvals := func(required int) Option {
+		return WithApprovals("Open", workflow.ApprovalSet{Approve: "Approve", Reject: "Reject", Groups: []workflow.ApprovalGroup{
+			{Name: "reviewers", Approvers: []string{"lead", "sre"}, Required: required},
+		}})
+	}
+
+	// 多个服务在同一个 Registry 上配置不同的会签规则，互不影响，也不修改 Registry 中的状态机
+	mockStore := store.NewMockStore()
+	services := make(map[string]*TicketService)
+	for name, opt := range map[string]Option{"all": approvals(2), "any": approvals(1), "none": func(*TicketService) {}} {
+		ts, err := NewTicketServiceWithRegistry(mockStore, registry, "review", WithPolicy(policy), opt)
+		if err != nil {
+			t.Fatalf("NewTicketServiceWithRegistry(%s) error = %v", name, err)
+		}
+		services[name] = ts
+	}
+	if legacy.Frozen() {
+		t.Error("service froze a machine owned by the registry")
+	}
+
+	ctx := context.Background()
+	for name, want := range map[string]string{"all": "Open", "any": "Approved", "none": "Approved"} {
+		ts := services[name]
+		if err := ts.CreateTicket(ctx, &model.Ticket{ID: name, CreatorID: "user123"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.TransitionTicket(ctx, name, "Approve", "lead"); err != nil {
+			t.Fatalf("%s: Approve error = %v", name, err)
+		}
+		if got, _ := mockStore.GetTicket(ctx, name); got.CurrentState != want {
+			t.Errorf("%s: state after one approval = %s, want %s", name, got.CurrentState, want)
+		}
+	}
+}
+
+// racingStore 在前 conflicts 次保存前抢先修改存储中的工单，模拟另一个服务实例的并发写入
+type racingStore struct {
+	*store.MockStore
+	conflicts int
+}
+
+func (s *racingStore) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
+	if s.conflicts > 0 && ticket.Version > 0 {
+		s.conflicts--
+		other, _ := s.MockStore.GetTicket(ctx, ticket.ID)
+		other.Description += "+"
+		if err := s.MockStore.SaveTicket(ctx, other); err != nil {
+			return err
+		}
+	}
+	return s.MockStore.SaveTicket(ctx, ticket)
+}
+
+func TestTicketService_ConflictRetry(t *testing.T) {
+	ctx := context.Background()
+	newTicket := func(s store.TicketStore) {
+		t.Helper()
+		if err := s.SaveTicket(ctx, &model.Ticket{ID: "test-ticket", CurrentState: string(workflow.StateNew), CreatorID: "user123"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 冲突次数在重试范围内：重新读取后转换成功，另一实例的修改不会丢失
+	racing := &racingStore{MockStore: store.NewMockStore()}
+	newTicket(racing)
+	racing.conflicts = 2
+	ts := NewTicketService(racing, WithPolicy(newTestPolicy()))
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventSubmit, "user123"); err != nil {
+		t.Fatalf("TransitionTicket() error = %v", err)
+	}
+	got, _ := racing.GetTicket(ctx, "test-ticket")
+	if got.CurrentState != string(workflow.StatePending) || got.Description != "++" || len(got.History) != 1 {
+		t.Errorf("ticket = state %s, description %q, %d history entries; want Pending, \"++\", 1", got.CurrentState, got.Description, len(got.History))
+	}
+	if got.Version != 4 {
+		t.Errorf("Version = %d, want 4", got.Version)
+	}
+
+	// 重试用尽后返回冲突错误，存储中只有另一实例的修改
+	racing = &racingStore{MockStore: store.NewMockStore()}
+	newTicket(racing)
+	racing.conflicts = 2
+	ts = NewTicketService(racing, WithPolicy(newTestPolicy()), WithConflictRetries(1))
+	err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventSubmit, "user123")
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatalf("TransitionTicket() error = %v, want ErrVersionConflict", err)
+	}
+	got, _ = racing.GetTicket(ctx, "test-ticket")
+	if got.CurrentState != string(workflow.StateNew) || len(got.History) != 0 {
+		t.Errorf("ticket = state %s, %d history entries; want New, 0", got.CurrentState, len(got.History))
+	}
+}
+
+// lockingStore 以互斥锁实现 store.Updater，记录 UpdateTicket 的调用次数
+type lockingStore struct {
+	*store.MockStore
+	mu      sync.Mutex
+	updates int
+}
+
+func (s *lockingStore) UpdateTicket(ctx context.Context, id string, fn func(*model.Ticket) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	ticket, err := s.GetTicket(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := fn(ticket); err != nil {
+		return err
+	}
+	return s.SaveTicket(ctx, ticket)
+}
+
+func TestTicketService_Updater(t *testing.T) {
+	locking := &lockingStore{MockStore: store.NewMockStore()}
+	ts := NewTicketService(locking, WithPolicy(newTestPolicy()))
+	ctx := context.Background()
+	if err := ts.CreateTicket(ctx, &model.Ticket{ID: "test-ticket", CreatorID: "user123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventSubmit, "user123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.TransitionTicket(ctx, "test-ticket", workflow.EventApproveFinal, "user123"); !errors.Is(err, workflow.ErrInvalidTransition) {
+		t.Errorf("TransitionTicket(ApproveFinal) error = %v, want ErrInvalidTransition", err)
+	}
+	if locking.updates != 2 {
+		t.Errorf("UpdateTicket calls = %d, want 2", locking.updates)
+	}
+	got, _ := locking.GetTicket(ctx, "test-ticket")
+	if got.CurrentState != string(workflow.StatePending) || len(got.History) != 1 || got.Version != 2 {
+		t.Errorf("ticket = state %s, %d history entries, version %d; want Pending, 1, 2", got.CurrentState, len(got.History), got.Version)
+	}
+}
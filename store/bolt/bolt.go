@@ -0,0 +1,347 @@
+// Package bolt 基于嵌入式 B+ 树键值库 bbolt 的 store.TicketStore 实现，无需数据库服务。
+//
+// 数据保存在以下 bucket 中，一次保存的全部修改在同一个写事务中完成：
+//
+//	tickets      工单 ID → 工单 JSON（不含历史）
+//	history      工单 ID → 子 bucket：序号（8 字节大端）→ 历史条目 JSON
+//	by_state     状态 + "\x00" + 工单 ID → 空
+//	by_assignee  处理人 + "\x00" + 工单 ID → 空
+//	by_creator   创建人 + "\x00" + 工单 ID → 空
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	bbolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketTickets = []byte("tickets")
+	bucketHistory = []byte("history")
+)
+
+// index 二级索引：bucket 名称与被索引的字段
+type index struct {
+	bucket []byte
+	value  func(*model.Ticket) string
+}
+
+var indexes = []index{
+	{[]byte("by_state"), func(t *model.Ticket) string { return t.CurrentState }},
+	{[]byte("by_assignee"), func(t *model.Ticket) string { return t.AssigneeID }},
+	{[]byte("by_creator"), func(t *model.Ticket) string { return t.CreatorID }},
+}
+
+// Store 可在 goroutine 间并发使用；bbolt 同一时间只允许一个写事务，数据库文件只能由一个进程打开
+type Store struct {
+	db *bbolt.DB
+}
+
+// Open 打开或创建 path 处的数据库。文件被其他进程占用时等待最多 1 秒后返回错误
+func Open(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0o644, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		names := [][]byte{bucketTickets, bucketHistory}
+		for _, idx := range indexes {
+			names = append(names, idx.bucket)
+		}
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveTicket 在一个写事务中写入工单、索引与新增的历史，版本不一致时返回 *store.ConflictError
+func (s *Store) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
+	var next int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		next, err = save(tx, ticket)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ticket.Version = next
+	return nil
+}
+
+// UpdateTicket 在一个写事务中读取工单、调用 fn 并保存，写事务互斥，期间不会有其他写入
+func (s *Store) UpdateTicket(ctx context.Context, id string, fn func(ticket *model.Ticket) error) error {
+	var ticket *model.Ticket
+	var next int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		if ticket, err = load(tx, id); err != nil {
+			return err
+		}
+		if err := fn(ticket); err != nil {
+			return err
+		}
+		next, err = save(tx, ticket)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ticket.Version = next
+	return nil
+}
+
+// save 在 tx 中写入工单并返回新版本号，事务提交前不修改 ticket
+func save(tx *bbolt.Tx, ticket *model.Ticket) (int64, error) {
+	id := []byte(ticket.ID)
+	tickets := tx.Bucket(bucketTickets)
+	var old *model.Ticket
+	if data := tickets.Get(id); data != nil {
+		old = new(model.Ticket)
+		if err := json.Unmarshal(data, old); err != nil {
+			return 0, fmt.Errorf("ticket %s: %w", ticket.ID, err)
+		}
+	}
+	var stored int64
+	if old != nil {
+		stored = old.Version
+	}
+	if ticket.Version != stored {
+		return 0, &store.ConflictError{ID: ticket.ID, Version: ticket.Version, Stored: stored}
+	}
+
+	record := *ticket
+	record.Version++
+	record.History = nil
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return 0, err
+	}
+	if err := tickets.Put(id, data); err != nil {
+		return 0, err
+	}
+
+	for _, idx := range indexes {
+		b := tx.Bucket(idx.bucket)
+		if old != nil {
+			if err := b.Delete(indexKey(idx.value(old), ticket.ID)); err != nil {
+				return 0, err
+			}
+		}
+		if err := b.Put(indexKey(idx.value(ticket), ticket.ID), nil); err != nil {
+			return 0, err
+		}
+	}
+
+	// 历史整体重写，调用方修改或截短已有条目时与其他存储一样保存
+	histories := tx.Bucket(bucketHistory)
+	if histories.Bucket(id) != nil {
+		if err := histories.DeleteBucket(id); err != nil {
+			return 0, err
+		}
+	}
+	history, err := histories.CreateBucket(id)
+	if err != nil {
+		return 0, err
+	}
+	for i, h := range ticket.History {
+		data, err := json.Marshal(h)
+		if err != nil {
+			return 0, err
+		}
+		if err := history.Put(seqKey(i), data); err != nil {
+			return 0, err
+		}
+	}
+	return record.Version, nil
+}
+
+func (s *Store) GetTicket(ctx context.Context, id string) (*model.Ticket, error) {
+	var ticket *model.Ticket
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		ticket, err = load(tx, id)
+		return err
+	})
+	return ticket, err
+}
+
+// load 读取工单及其历史
+func load(tx *bbolt.Tx, id string) (*model.Ticket, error) {
+	ticket, err := loadRecord(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadHistory(tx, ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// loadRecord 读取不含历史的工单
+func loadRecord(tx *bbolt.Tx, id string) (*model.Ticket, error) {
+	data := tx.Bucket(bucketTickets).Get([]byte(id))
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s", store.ErrTicketNotFound, id)
+	}
+	var ticket model.Ticket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return nil, fmt.Errorf("ticket %s: %w", id, err)
+	}
+	return &ticket, nil
+}
+
+func loadHistory(tx *bbolt.Tx, ticket *model.Ticket) error {
+	history := tx.Bucket(bucketHistory).Bucket([]byte(ticket.ID))
+	if history == nil {
+		return nil
+	}
+	return history.ForEach(func(_, v []byte) error {
+		var h model.History
+		if err := json.Unmarshal(v, &h); err != nil {
+			return fmt.Errorf("ticket %s history: %w", ticket.ID, err)
+		}
+		ticket.History = append(ticket.History, h)
+		return nil
+	})
+}
+
+// ListTickets 从索引中最小的候选集合读取不含历史的工单，在内存中过滤、排序并分页后只为返回的工单读取历史。
+// 没有状态、处理人、创建人条件时遍历全部工单
+func (s *Store) ListTickets(ctx context.Context, q store.Query) (*store.Page, error) {
+	var page *store.Page
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var tickets []*model.Ticket
+		err := candidates(tx, q, func(id string) error {
+			ticket, err := loadRecord(tx, id)
+			if err != nil {
+				return err
+			}
+			tickets = append(tickets, ticket)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if page, err = q.Apply(tickets); err != nil {
+			return err
+		}
+		for _, ticket := range page.Tickets {
+			if err := loadHistory(tx, ticket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return page, err
+}
+
+// candidates 对索引条件选出的最小候选集合中的每个工单 ID 调用 fn，没有索引条件时对全部工单调用
+func candidates(tx *bbolt.Tx, q store.Query, fn func(id string) error) error {
+	var ids []string
+	found := false
+	narrow := func(set []string) {
+		if !found || len(set) < len(ids) {
+			ids, found = set, true
+		}
+	}
+	if len(q.States) > 0 {
+		var set []string
+		seen := make(map[string]bool)
+		for _, state := range q.States {
+			if !seen[state] {
+				seen[state] = true
+				set = append(set, indexed(tx, indexes[0], state)...)
+			}
+		}
+		narrow(set)
+	}
+	if q.AssigneeID != "" {
+		narrow(indexed(tx, indexes[1], q.AssigneeID))
+	}
+	if q.CreatorID != "" {
+		narrow(indexed(tx, indexes[2], q.CreatorID))
+	}
+
+	if !found {
+		return tx.Bucket(bucketTickets).ForEach(func(k, _ []byte) error {
+			return fn(string(k))
+		})
+	}
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TicketsByState 通过索引返回处于 state 的工单，按 ID 排序
+func (s *Store) TicketsByState(ctx context.Context, state string) ([]*model.Ticket, error) {
+	return s.byIndex(indexes[0], state)
+}
+
+// TicketsByAssignee 通过索引返回处理人为 assignee 的工单，按 ID 排序
+func (s *Store) TicketsByAssignee(ctx context.Context, assignee string) ([]*model.Ticket, error) {
+	return s.byIndex(indexes[1], assignee)
+}
+
+// TicketsByCreator 通过索引返回创建人为 creator 的工单，按 ID 排序
+func (s *Store) TicketsByCreator(ctx context.Context, creator string) ([]*model.Ticket, error) {
+	return s.byIndex(indexes[2], creator)
+}
+
+func (s *Store) byIndex(idx index, value string) ([]*model.Ticket, error) {
+	var tickets []*model.Ticket
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for _, id := range indexed(tx, idx, value) {
+			ticket, err := load(tx, id)
+			if err != nil {
+				return err
+			}
+			tickets = append(tickets, ticket)
+		}
+		return nil
+	})
+	return tickets, err
+}
+
+// indexed 按前缀扫描索引，返回字段等于 value 的工单 ID，按 ID 排序
+func indexed(tx *bbolt.Tx, idx index, value string) []string {
+	var ids []string
+	prefix := indexKey(value, "")
+	c := tx.Bucket(idx.bucket).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, string(k[len(prefix):]))
+	}
+	return ids
+}
+
+// indexKey 以 "\x00" 分隔字段值与工单 ID，保证前缀扫描不会匹配到以 value 开头的其他值
+func indexKey(value, id string) []byte {
+	return []byte(value + "\x00" + id)
+}
+
+// seqKey 大端编码的序号按字节序排列即为追加顺序
+func seqKey(i int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(i))
+}
@@ -0,0 +1,106 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/store/storetest"
+)
+
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.TicketStore {
+		return open(t, filepath.Join(t.TempDir(), "tickets.db"))
+	})
+}
+
+func TestStore_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.db")
+	s := open(t, path)
+	ticket := storetest.NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	got, err := open(t, path).GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.AssertEqual(t, got, ticket)
+}
+
+func TestStore_Indexes(t *testing.T) {
+	ids := func(tickets []*model.Ticket, err error) []string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, ticket := range tickets {
+			ids = append(ids, ticket.ID)
+		}
+		return ids
+	}
+	ctx := context.Background()
+	s := open(t, filepath.Join(t.TempDir(), "tickets.db"))
+	for _, ticket := range []*model.Ticket{
+		{ID: "t1", CurrentState: "Working", AssigneeID: "bob", CreatorID: "alice"},
+		{ID: "t2", CurrentState: "Working", AssigneeID: "bobby", CreatorID: "alice"},
+		{ID: "t3", CurrentState: "Pending", CreatorID: "carol"},
+	} {
+		if err := s.SaveTicket(ctx, ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"state Working", ids(s.TicketsByState(ctx, "Working")), []string{"t1", "t2"}},
+		{"assignee bob", ids(s.TicketsByAssignee(ctx, "bob")), []string{"t1"}},
+		{"no assignee", ids(s.TicketsByAssignee(ctx, "")), []string{"t3"}},
+		{"creator alice", ids(s.TicketsByCreator(ctx, "alice")), []string{"t1", "t2"}},
+		{"unknown state", ids(s.TicketsByState(ctx, "Closed")), nil},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// 保存后旧的索引项被移除
+	err := s.UpdateTicket(ctx, "t1", func(ticket *model.Ticket) error {
+		ticket.CurrentState = "OnHold"
+		ticket.AssigneeID = "dave"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(s.TicketsByState(ctx, "Working")); !reflect.DeepEqual(got, []string{"t2"}) {
+		t.Errorf("state Working after update = %v, want [t2]", got)
+	}
+	if got := ids(s.TicketsByAssignee(ctx, "bob")); got != nil {
+		t.Errorf("assignee bob after update = %v, want none", got)
+	}
+	if got := ids(s.TicketsByAssignee(ctx, "dave")); !reflect.DeepEqual(got, []string{"t1"}) {
+		t.Errorf("assignee dave after update = %v, want [t1]", got)
+	}
+}
@@ -0,0 +1,136 @@
+// Package sqlquery 将 store.Query 转换为 SQL 子句，供基于 SQL 的存储共用
+package sqlquery
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kekexiaoai/ticket/store"
+)
+
+// Builder 生成查询子句，占位符统一为 ?，由调用方按方言改写。
+// 各数据库保存时间的方式不同，由 Time 与 TimeArg 描述
+type Builder struct {
+	// Time 返回时间列用于比较与排序的表达式，为 nil 时直接使用列名
+	Time func(column string) string
+	// TimeArg 将时间转换为与 Time 表达式比较的参数，为 nil 时直接使用 time.Time
+	TimeArg func(t time.Time) any
+}
+
+// Build 返回 q 在 FROM tickets 之后的 WHERE、ORDER BY 与 LIMIT 子句及其参数。
+// 有 Limit 时多读一条，调用方以读取结果调用 q.NewPage 判断是否还有下一页
+func (b Builder) Build(q store.Query) (string, []any, error) {
+	if _, err := store.ParseSortKey(string(q.Sort)); err != nil {
+		return "", nil, err
+	}
+	after, err := q.DecodeCursor()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var conds []string
+	var args []any
+	if len(q.States) > 0 {
+		conds = append(conds, "current_state IN ("+Placeholders(len(q.States))+")")
+		for _, state := range q.States {
+			args = append(args, state)
+		}
+	}
+	if q.AssigneeID != "" {
+		conds = append(conds, "assignee_id = ?")
+		args = append(args, q.AssigneeID)
+	}
+	if q.CreatorID != "" {
+		conds = append(conds, "creator_id = ?")
+		args = append(args, q.CreatorID)
+	}
+	if q.MinPriority != nil {
+		conds = append(conds, "priority >= ?")
+		args = append(args, *q.MinPriority)
+	}
+	if q.MaxPriority != nil {
+		conds = append(conds, "priority <= ?")
+		args = append(args, *q.MaxPriority)
+	}
+	ranges := []struct {
+		column string
+		r      store.TimeRange
+	}{{"created_at", q.Created}, {"updated_at", q.Updated}}
+	for _, tr := range ranges {
+		if !tr.r.From.IsZero() {
+			conds = append(conds, b.time(tr.column)+" >= ?")
+			args = append(args, b.timeArg(tr.r.From))
+		}
+		if !tr.r.To.IsZero() {
+			conds = append(conds, b.time(tr.column)+" < ?")
+			args = append(args, b.timeArg(tr.r.To))
+		}
+	}
+
+	// 键集分页：排序值在游标之后，或排序值相同而 ID 在游标之后
+	op, dir := ">", "ASC"
+	if q.Desc {
+		op, dir = "<", "DESC"
+	}
+	column := b.sortColumn(q.SortKey())
+	if after != nil {
+		if column == "" {
+			conds = append(conds, "id "+op+" ?")
+			args = append(args, after.ID)
+		} else {
+			var value any = after.Priority
+			if after.Sort != store.SortByPriority {
+				value = b.timeArg(after.Time)
+			}
+			conds = append(conds, "("+column+" "+op+" ? OR ("+column+" = ? AND id "+op+" ?))")
+			args = append(args, value, value, after.ID)
+		}
+	}
+
+	var sb strings.Builder
+	if len(conds) > 0 {
+		sb.WriteString("WHERE " + strings.Join(conds, " AND ") + " ")
+	}
+	sb.WriteString("ORDER BY ")
+	if column != "" {
+		sb.WriteString(column + " " + dir + ", ")
+	}
+	sb.WriteString("id " + dir)
+	if q.Limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(q.Limit+1))
+	}
+	return sb.String(), args, nil
+}
+
+// sortColumn 返回排序字段的表达式，按 ID 排序时为空
+func (b Builder) sortColumn(k store.SortKey) string {
+	switch k {
+	case store.SortByPriority:
+		return "priority"
+	case store.SortByCreatedAt:
+		return b.time("created_at")
+	case store.SortByUpdatedAt:
+		return b.time("updated_at")
+	}
+	return ""
+}
+
+func (b Builder) time(column string) string {
+	if b.Time == nil {
+		return column
+	}
+	return b.Time(column)
+}
+
+func (b Builder) timeArg(t time.Time) any {
+	if b.TimeArg == nil {
+		return t
+	}
+	return b.TimeArg(t)
+}
+
+// Placeholders 返回以逗号分隔的 n 个 ?
+func Placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,258 @@
+// Package jsonl 基于追加写 JSON Lines 日志的 store.TicketStore 实现，适用于单机部署。
+//
+// 每次 SaveTicket 将工单完整地以一行 JSON 追加到日志并 fsync，同一工单的后一行覆盖前一行。
+// 启动时重放日志重建内存索引，崩溃导致的最后一行不完整时截掉该行。
+// 被覆盖的旧记录超过阈值后自动压缩：只保留每个工单的最新记录并原子替换日志文件。
+// 同一日志文件只能由一个进程打开。
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+)
+
+// DefaultCompactThreshold 被覆盖的旧记录达到该数量时自动压缩
+const DefaultCompactThreshold = 1000
+
+// Option 配置 Store
+type Option func(*Store)
+
+// WithCompactThreshold 设置自动压缩的阈值，0 表示不自动压缩，只在调用 Compact 时压缩
+func WithCompactThreshold(n int) Option {
+	return func(s *Store) {
+		s.threshold = n
+	}
+}
+
+// Store 在内存中保存每个工单的最新版本，写入时追加日志，可在 goroutine 间并发使用
+type Store struct {
+	mu        sync.RWMutex
+	path      string
+	file      *os.File
+	tickets   map[string]*model.Ticket
+	records   int // 日志中的记录数，减去工单数即为被覆盖的旧记录数
+	threshold int
+}
+
+// Open 打开或创建 path 处的日志并重放。最后一行不完整时视为崩溃中断的写入并截掉，
+// 其他行损坏时返回错误，需要人工处理
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{path: path, tickets: make(map[string]*model.Ticket), threshold: DefaultCompactThreshold}
+	for _, opt := range opts {
+		opt(s)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replay(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := syncDir(path); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+// replay 逐行读取日志重建索引，并把文件截断到最后一条完整记录之后
+func (s *Store) replay(f *os.File) error {
+	r := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(data) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		var ticket model.Ticket
+		if jsonErr := json.Unmarshal(data, &ticket); jsonErr != nil {
+			if _, peekErr := r.Peek(1); !errors.Is(peekErr, io.EOF) {
+				return fmt.Errorf("%s:%d: corrupt record", s.path, line)
+			}
+			log.Printf("%s:%d: 截掉不完整的最后一条记录 (%d 字节)", s.path, line, len(data))
+			break
+		}
+		offset += int64(len(data))
+		s.tickets[ticket.ID] = &ticket
+		s.records++
+		if errors.Is(err, io.EOF) {
+			// 完整的 JSON 但缺少换行符，补上换行后继续追加
+			if _, err := f.WriteAt([]byte("\n"), offset); err != nil {
+				return err
+			}
+			offset++
+			break
+		}
+	}
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *Store) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stored int64
+	if old, ok := s.tickets[ticket.ID]; ok {
+		stored = old.Version
+	}
+	if ticket.Version != stored {
+		return &store.ConflictError{ID: ticket.ID, Version: ticket.Version, Stored: stored}
+	}
+
+	saved := ticket.Clone()
+	saved.Version++
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := s.append(append(data, '\n')); err != nil {
+		return err
+	}
+	s.tickets[saved.ID] = saved
+	s.records++
+	ticket.Version = saved.Version
+
+	if s.threshold > 0 && s.records-len(s.tickets) >= s.threshold {
+		if err := s.compact(); err != nil {
+			// 日志已经写入，压缩失败不影响本次保存，下次保存时重试
+			log.Printf("%s: 压缩失败: %v", s.path, err)
+		}
+	}
+	return nil
+}
+
+// append 追加一条记录并 fsync。写入失败时截掉写了一半的内容，避免后续记录接在损坏的行之后
+func (s *Store) append(line []byte) error {
+	offset, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(line); err != nil {
+		s.file.Truncate(offset)
+		s.file.Seek(offset, io.SeekStart)
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *Store) GetTicket(ctx context.Context, id string) (*model.Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ticket, ok := s.tickets[id]; ok {
+		return ticket.Clone(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", store.ErrTicketNotFound, id)
+}
+
+// ListTickets 在内存中扫描全部工单执行查询，没有二级索引
+func (s *Store) ListTickets(ctx context.Context, q store.Query) (*store.Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tickets := make([]*model.Ticket, 0, len(s.tickets))
+	for _, ticket := range s.tickets {
+		tickets = append(tickets, ticket)
+	}
+	page, err := q.Apply(tickets)
+	if err != nil {
+		return nil, err
+	}
+	for i, ticket := range page.Tickets {
+		page.Tickets[i] = ticket.Clone()
+	}
+	return page, nil
+}
+
+func (s *Store) sorted() []*model.Ticket {
+	tickets := make([]*model.Ticket, 0, len(s.tickets))
+	for _, ticket := range s.tickets {
+		tickets = append(tickets, ticket.Clone())
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].ID < tickets[j].ID })
+	return tickets
+}
+
+// Compact 将日志重写为每个工单一条最新记录，可由调用方定期执行
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+// compact 先写临时文件再重命名，保证日志要么是旧内容要么是新内容
+func (s *Store) compact() error {
+	var buf bytes.Buffer
+	for _, ticket := range s.sorted() {
+		data, err := json.Marshal(ticket)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 临时文件已经成为新的日志，后续追加写入它
+	s.file.Close()
+	s.file = tmp
+	s.records = len(s.tickets)
+	return syncDir(s.path)
+}
+
+// Close 关闭日志文件，之后不能再使用 Store
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// syncDir fsync 日志所在目录，使新建与重命名的文件在崩溃后仍然存在
+func syncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,169 @@
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/store/storetest"
+)
+
+func open(t *testing.T, path string, opts ...Option) *Store {
+	t.Helper()
+	s, err := Open(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.TicketStore {
+		return open(t, filepath.Join(t.TempDir(), "tickets.jsonl"))
+	})
+}
+
+func TestStore_Replay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	s := open(t, path)
+	ticket := storetest.NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	ticket.Title = "updated"
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	got, err := open(t, path).GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.AssertEqual(t, got, ticket)
+}
+
+func TestStore_TruncatedLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	s := open(t, path)
+	ticket := storetest.NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// 模拟写入第二条记录时崩溃
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"t1","title":"lost","vers`)
+	f.Close()
+
+	s = open(t, path)
+	got, err := s.GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.AssertEqual(t, got, ticket)
+
+	// 截断后继续追加，重新打开时日志完好
+	got.Title = "after crash"
+	if err := s.SaveTicket(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if n := lines(t, path); n != 2 {
+		t.Errorf("log has %d lines, want 2", n)
+	}
+	again, err := open(t, path).GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.AssertEqual(t, again, got)
+}
+
+func TestStore_CorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	content := `{"id":"t1","version":1}` + "\n" + `garbage` + "\n" + `{"id":"t2","version":1}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("Open() with a corrupt record in the middle succeeded, want error")
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	s := open(t, path, WithCompactThreshold(0))
+	a, b := storetest.NewTicket("a"), storetest.NewTicket("b")
+	for i := 0; i < 5; i++ {
+		for _, ticket := range []*model.Ticket{a, b} {
+			ticket.ReassignCount = i
+			if err := s.SaveTicket(ctx, ticket); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := lines(t, path); n != 10 {
+		t.Fatalf("log has %d lines before Compact, want 10", n)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := lines(t, path); n != 2 {
+		t.Errorf("log has %d lines after Compact, want 2", n)
+	}
+	// 压缩后继续追加到新的日志
+	a.Title = "after compact"
+	if err := s.SaveTicket(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = open(t, path)
+	for _, want := range []*model.Ticket{a, b} {
+		got, err := s.GetTicket(ctx, want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storetest.AssertEqual(t, got, want)
+	}
+}
+
+func TestStore_AutoCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.jsonl")
+	s := open(t, path, WithCompactThreshold(3))
+	ticket := storetest.NewTicket("t1")
+	for i := 0; i < 4; i++ {
+		if err := s.SaveTicket(ctx, ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第 4 次保存后有 3 条旧记录，压缩为 1 行
+	if n := lines(t, path); n != 1 {
+		t.Errorf("log has %d lines, want 1 after automatic compaction", n)
+	}
+	if ticket.Version != 4 {
+		t.Errorf("Version = %d, want 4", ticket.Version)
+	}
+}
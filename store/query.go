@@ -0,0 +1,236 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+// ErrInvalidCursor 分页游标无法解析，或与查询的排序方式不一致
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortKey 工单列表的排序字段，相同时按 ID 排序
+type SortKey string
+
+const (
+	SortByID        SortKey = "id"
+	SortByPriority  SortKey = "priority"
+	SortByCreatedAt SortKey = "created_at"
+	SortByUpdatedAt SortKey = "updated_at"
+)
+
+// ParseSortKey 解析排序字段，空字符串为 SortByID
+func ParseSortKey(s string) (SortKey, error) {
+	switch k := SortKey(s); k {
+	case "":
+		return SortByID, nil
+	case SortByID, SortByPriority, SortByCreatedAt, SortByUpdatedAt:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown sort key %q", s)
+}
+
+// TimeRange 左闭右开的时间范围 [From, To)，零值表示该端不限
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains 判断 t 是否在范围内
+func (r TimeRange) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// Query 工单列表查询。各条件同时满足，零值的条件不限制；
+// 例如“分配给我的 InitialReview 工单，优先级从高到低”：
+//
+//	store.Query{States: []string{"InitialReview"}, AssigneeID: me, Sort: store.SortByPriority, Desc: true}
+//
+// 工单只会处于叶子状态，States 按 CurrentState 精确匹配，不展开复合状态：
+// 查询 InProgress 中的工单需要传入 workflow.StateMachine.LeafStates(InProgress) 返回的子状态。
+type Query struct {
+	States      []string // CurrentState 等于其中之一
+	AssigneeID  string
+	CreatorID   string
+	MinPriority *int // 优先级下限（含），nil 表示不限
+	MaxPriority *int // 优先级上限（含），nil 表示不限
+	Created     TimeRange
+	Updated     TimeRange
+
+	Sort SortKey // 默认为 SortByID
+	Desc bool    // 降序，相同排序值的工单同样按 ID 降序
+
+	Limit  int    // 每页最多返回的工单数，0 表示不分页
+	Cursor string // 上一页的 Page.NextCursor，为空时从第一页开始
+}
+
+// Page 一页查询结果
+type Page struct {
+	Tickets []*model.Ticket
+	// NextCursor 下一页的游标，没有更多结果时为空
+	NextCursor string
+}
+
+// SortKey 返回查询的排序字段，未设置时为 SortByID
+func (q Query) SortKey() SortKey {
+	if q.Sort == "" {
+		return SortByID
+	}
+	return q.Sort
+}
+
+// Matches 判断工单是否满足查询的过滤条件，不考虑排序与分页
+func (q Query) Matches(t *model.Ticket) bool {
+	if len(q.States) > 0 && !contains(q.States, t.CurrentState) {
+		return false
+	}
+	if q.AssigneeID != "" && t.AssigneeID != q.AssigneeID {
+		return false
+	}
+	if q.CreatorID != "" && t.CreatorID != q.CreatorID {
+		return false
+	}
+	if q.MinPriority != nil && t.Priority < *q.MinPriority {
+		return false
+	}
+	if q.MaxPriority != nil && t.Priority > *q.MaxPriority {
+		return false
+	}
+	return q.Created.Contains(t.CreatedAt) && q.Updated.Contains(t.UpdatedAt)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查排序字段与游标
+func (q Query) Validate() error {
+	if _, err := ParseSortKey(string(q.Sort)); err != nil {
+		return err
+	}
+	_, err := q.DecodeCursor()
+	return err
+}
+
+// Apply 在内存中对 tickets 执行查询：过滤、排序并取出游标之后的一页。
+// 没有查询下推能力的存储以全部或经索引筛选的候选工单调用它
+func (q Query) Apply(tickets []*model.Ticket) (*Page, error) {
+	if _, err := ParseSortKey(string(q.Sort)); err != nil {
+		return nil, err
+	}
+	after, err := q.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+	var matched []*model.Ticket
+	for _, t := range tickets {
+		if q.Matches(t) && (after == nil || after.Before(t)) {
+			matched = append(matched, t)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return q.less(matched[i], matched[j]) })
+	return q.NewPage(matched), nil
+}
+
+// NewPage 由已排序且位于游标之后的工单生成一页：超过 Limit 的部分截掉并生成下一页的游标。
+// 存储可以多读一条（Limit+1）以判断是否还有下一页
+func (q Query) NewPage(tickets []*model.Ticket) *Page {
+	if q.Limit <= 0 || len(tickets) <= q.Limit {
+		return &Page{Tickets: tickets}
+	}
+	tickets = tickets[:q.Limit]
+	return &Page{Tickets: tickets, NextCursor: q.cursorAt(tickets[len(tickets)-1]).encode()}
+}
+
+// less 判断按查询的排序方式 a 是否排在 b 之前
+func (q Query) less(a, b *model.Ticket) bool {
+	return q.cursorAt(a).Before(b)
+}
+
+// Cursor 分页位置：上一页最后一个工单的排序字段值与 ID
+type Cursor struct {
+	Sort     SortKey   `json:"sort"`
+	Desc     bool      `json:"desc,omitempty"`
+	Priority int       `json:"priority,omitempty"`
+	Time     time.Time `json:"time,omitzero"`
+	ID       string    `json:"id"`
+}
+
+func (q Query) cursorAt(t *model.Ticket) *Cursor {
+	c := &Cursor{Sort: q.SortKey(), Desc: q.Desc, ID: t.ID}
+	switch c.Sort {
+	case SortByPriority:
+		c.Priority = t.Priority
+	case SortByCreatedAt:
+		c.Time = t.CreatedAt.UTC()
+	case SortByUpdatedAt:
+		c.Time = t.UpdatedAt.UTC()
+	}
+	return c
+}
+
+// Before 判断游标位置是否排在工单 t 之前，即 t 属于后续的页
+func (c *Cursor) Before(t *model.Ticket) bool {
+	cmp := 0
+	switch c.Sort {
+	case SortByPriority:
+		cmp = compare(c.Priority, t.Priority)
+	case SortByCreatedAt:
+		cmp = c.Time.Compare(t.CreatedAt)
+	case SortByUpdatedAt:
+		cmp = c.Time.Compare(t.UpdatedAt)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(c.ID, t.ID)
+	}
+	if c.Desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func compare(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (c *Cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor 解析查询的游标，Cursor 为空时返回 nil。
+// 游标的排序方式与查询不一致时返回 ErrInvalidCursor
+func (q Query) DecodeCursor() (*Cursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if c.Sort != q.SortKey() || c.Desc != q.Desc {
+		return nil, fmt.Errorf("%w: cursor is for sort %s desc=%t", ErrInvalidCursor, c.Sort, c.Desc)
+	}
+	return &c, nil
+}
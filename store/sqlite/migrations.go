@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// execer 迁移使用的数据库连接，迁移执行时连接已处于 BEGIN IMMEDIATE 开始的事务中
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// migration 在事务中执行的一次结构或数据迁移
+type migration func(ctx context.Context, tx execer) error
+
+// execSQL 返回执行 stmt 的迁移
+func execSQL(stmt string) migration {
+	return func(ctx context.Context, tx execer) error {
+		_, err := tx.ExecContext(ctx, stmt)
+		return err
+	}
+}
+
+// migrations 按顺序执行的迁移，第 i 个迁移的版本号为 i+1。
+// 已发布的迁移不能修改，结构变化只能追加新的迁移
+var migrations = []migration{
+	// 1: 工单与历史，会签投票以 JSON 数组保存在 approvals 列
+	execSQL(`CREATE TABLE tickets (
+		id               TEXT PRIMARY KEY,
+		title            TEXT NOT NULL,
+		description      TEXT NOT NULL,
+		type             TEXT NOT NULL,
+		priority         INTEGER NOT NULL,
+		initial_priority INTEGER NOT NULL,
+		reassign_count   INTEGER NOT NULL,
+		current_state    TEXT NOT NULL,
+		workflow_version TEXT NOT NULL,
+		version          INTEGER NOT NULL,
+		creator_id       TEXT NOT NULL,
+		assignee_id      TEXT NOT NULL,
+		created_at       TEXT NOT NULL,
+		updated_at       TEXT NOT NULL,
+		approvals        TEXT NOT NULL
+	);
+	CREATE INDEX tickets_type_state ON tickets (type, current_state);
+	CREATE TABLE ticket_history (
+		ticket_id    TEXT NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+		seq          INTEGER NOT NULL,
+		from_state   TEXT NOT NULL,
+		to_state     TEXT NOT NULL,
+		event        TEXT NOT NULL,
+		timestamp    TEXT NOT NULL,
+		triggered_by TEXT NOT NULL,
+		payload      TEXT NOT NULL,
+		PRIMARY KEY (ticket_id, seq)
+	);`),
+	// 2: 工单时间改为可按文本排序的 UTC 格式
+	normalizeTimes,
+	// 3: 列表查询的过滤条件
+	execSQL(`CREATE INDEX tickets_state ON tickets (current_state);
+	CREATE INDEX tickets_assignee ON tickets (assignee_id);
+	CREATE INDEX tickets_creator ON tickets (creator_id);`),
+}
+
+// normalizeTimes 将带时区偏移的 created_at、updated_at 改写为 formatTime 的格式
+func normalizeTimes(ctx context.Context, tx execer) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, created_at, updated_at FROM tickets`)
+	if err != nil {
+		return err
+	}
+	var updates [][3]string
+	for rows.Next() {
+		var id, createdAt, updatedAt string
+		if err := rows.Scan(&id, &createdAt, &updatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		updates = append(updates, [3]string{id, createdAt, updatedAt})
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, u := range updates {
+		createdAt, err := parseTime(u[1])
+		if err != nil {
+			return fmt.Errorf("ticket %s: %w", u[0], err)
+		}
+		updatedAt, err := parseTime(u[2])
+		if err != nil {
+			return fmt.Errorf("ticket %s: %w", u[0], err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE tickets SET created_at = ?, updated_at = ? WHERE id = ?`,
+			formatTime(createdAt), formatTime(updatedAt), u[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate 依次执行尚未应用的迁移，并在 schema_migrations 中记录版本。
+// 数据库版本高于程序已知的版本时拒绝打开，避免旧程序写入新结构
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	// BEGIN IMMEDIATE 与对应的 COMMIT 必须在同一个连接上执行
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		done, err := applyNext(ctx, conn)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// applyNext 在 BEGIN IMMEDIATE 事务中读取当前版本并执行下一个迁移，没有待执行的迁移时返回 true。
+// IMMEDIATE 事务开始时即获取写锁，多个进程同时打开数据库时依次执行，不会重复应用同一个迁移
+func applyNext(ctx context.Context, conn *sql.Conn) (done bool, err error) {
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(context.Background(), `ROLLBACK`)
+		}
+	}()
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return false, err
+	}
+	if current > len(migrations) {
+		return false, fmt.Errorf("database schema version %d is newer than supported version %d", current, len(migrations))
+	}
+	if current < len(migrations) {
+		version := current + 1
+		if err := migrations[current](ctx, conn); err != nil {
+			return false, fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return false, fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return false, err
+	}
+	return current == len(migrations), nil
+}
+
+// SchemaVersion 返回数据库已应用的迁移版本
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
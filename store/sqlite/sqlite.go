@@ -0,0 +1,252 @@
+// Package sqlite 基于 SQLite 的 store.TicketStore 实现，使用纯 Go 驱动 modernc.org/sqlite，无需 cgo
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/store/internal/sqlquery"
+	_ "modernc.org/sqlite"
+)
+
+// Store 将工单保存在 tickets 表，历史保存在 ticket_history 表，可在 goroutine 间并发使用
+type Store struct {
+	db *sql.DB
+}
+
+// Open 打开（不存在时创建）path 处的数据库并执行未应用的迁移。
+// 连接启用 WAL 与 busy_timeout，多个连接并发写入时等待而不是立即失败
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// dsn 返回 path 的 SQLite URI。路径经过转义，包含 ?、# 或 % 的路径不会被当作 URI 的查询参数或片段
+func dsn(path string) string {
+	u := url.URL{
+		Scheme:   "file",
+		Path:     path,
+		OmitHost: true, // 相对路径不能写成 file://path，否则 path 会被当作主机名
+		RawQuery: "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)",
+	}
+	return u.String()
+}
+
+// New 使用已打开的数据库并执行未应用的迁移
+func New(db *sql.DB) (*Store, error) {
+	if err := migrate(context.Background(), db); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveTicket 在一个事务中写入工单与全部历史，版本不一致时返回 *store.ConflictError
+func (s *Store) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
+	approvals, err := json.Marshal(ticket.Approvals)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先写后读：事务的第一条语句即获取写锁，避免读锁升级失败
+	next := ticket.Version + 1
+	args := []any{
+		ticket.Title, ticket.Description, ticket.Type, ticket.Priority, ticket.InitialPriority, ticket.ReassignCount,
+		ticket.CurrentState, ticket.WorkflowVersion, next, ticket.CreatorID, ticket.AssigneeID,
+		formatTime(ticket.CreatedAt), formatTime(ticket.UpdatedAt), string(approvals), ticket.ID,
+	}
+	var res sql.Result
+	if ticket.Version == 0 {
+		res, err = tx.ExecContext(ctx, `INSERT INTO tickets (title, description, type, priority, initial_priority, reassign_count,
+			current_state, workflow_version, version, creator_id, assignee_id, created_at, updated_at, approvals, id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`, args...)
+	} else {
+		res, err = tx.ExecContext(ctx, `UPDATE tickets SET title = ?, description = ?, type = ?, priority = ?, initial_priority = ?,
+			reassign_count = ?, current_state = ?, workflow_version = ?, version = ?, creator_id = ?, assignee_id = ?,
+			created_at = ?, updated_at = ?, approvals = ? WHERE id = ? AND version = ?`, append(args, ticket.Version)...)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		conflict := &store.ConflictError{ID: ticket.ID, Version: ticket.Version}
+		err := tx.QueryRowContext(ctx, `SELECT version FROM tickets WHERE id = ?`, ticket.ID).Scan(&conflict.Stored)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return conflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ticket_history WHERE ticket_id = ?`, ticket.ID); err != nil {
+		return err
+	}
+	for i, h := range ticket.History {
+		payload, err := json.Marshal(h.Payload)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO ticket_history (ticket_id, seq, from_state, to_state, event, timestamp, triggered_by, payload)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			ticket.ID, i, h.FromState, h.ToState, h.Event, formatTime(h.Timestamp), h.TriggeredBy, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ticket.Version = next
+	return nil
+}
+
+func (s *Store) GetTicket(ctx context.Context, id string) (*model.Ticket, error) {
+	tickets, err := s.query(ctx, `WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tickets) == 0 {
+		return nil, fmt.Errorf("%w: %s", store.ErrTicketNotFound, id)
+	}
+	return tickets[0], nil
+}
+
+// builder 时间列保存为定长的 UTC 文本，按文本比较即按时间比较
+var builder = sqlquery.Builder{TimeArg: func(t time.Time) any { return formatTime(t) }}
+
+// ListTickets 在数据库中过滤、排序与分页
+func (s *Store) ListTickets(ctx context.Context, q store.Query) (*store.Page, error) {
+	clause, args, err := builder.Build(q)
+	if err != nil {
+		return nil, err
+	}
+	tickets, err := s.query(ctx, clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	return q.NewPage(tickets), nil
+}
+
+// query 在一个只读事务中读取 clause 选出的工单及其历史，保证工单与历史来自同一快照
+func (s *Store) query(ctx context.Context, clause string, args ...any) ([]*model.Ticket, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, title, description, type, priority, initial_priority, reassign_count,
+		current_state, workflow_version, version, creator_id, assignee_id, created_at, updated_at, approvals
+		FROM tickets `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	var tickets []*model.Ticket
+	byID := make(map[string]*model.Ticket)
+	for rows.Next() {
+		var t model.Ticket
+		var createdAt, updatedAt, approvals string
+		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Type, &t.Priority, &t.InitialPriority, &t.ReassignCount,
+			&t.CurrentState, &t.WorkflowVersion, &t.Version, &t.CreatorID, &t.AssigneeID, &createdAt, &updatedAt, &approvals)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t.CreatedAt, err = parseTime(createdAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t.UpdatedAt, err = parseTime(updatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(approvals), &t.Approvals); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ticket %s approvals: %w", t.ID, err)
+		}
+		tickets = append(tickets, &t)
+		byID[t.ID] = &t
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]any, len(tickets))
+	for i, t := range tickets {
+		ids[i] = t.ID
+	}
+	for batch := range slices.Chunk(ids, historyBatch) {
+		if err := loadHistory(ctx, tx, batch, byID); err != nil {
+			return nil, err
+		}
+	}
+	return tickets, nil
+}
+
+// historyBatch 每次读取历史的工单数，避免超出 SQLite 的参数个数限制
+const historyBatch = 500
+
+// loadHistory 读取 ids 的历史并追加到 byID 中对应的工单
+func loadHistory(ctx context.Context, tx *sql.Tx, ids []any, byID map[string]*model.Ticket) error {
+	rows, err := tx.QueryContext(ctx, `SELECT ticket_id, from_state, to_state, event, timestamp, triggered_by, payload
+		FROM ticket_history WHERE ticket_id IN (`+sqlquery.Placeholders(len(ids))+`) ORDER BY ticket_id, seq`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ticketID, timestamp, payload string
+		var h model.History
+		if err := rows.Scan(&ticketID, &h.FromState, &h.ToState, &h.Event, &timestamp, &h.TriggeredBy, &payload); err != nil {
+			return err
+		}
+		if h.Timestamp, err = parseTime(timestamp); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(payload), &h.Payload); err != nil {
+			return fmt.Errorf("ticket %s history payload: %w", ticketID, err)
+		}
+		t := byID[ticketID]
+		t.History = append(t.History, h)
+	}
+	return rows.Err()
+}
+
+// timeFormat 定长的 UTC 时间格式，按文本排序即按时间排序；读取时也接受旧版本保存的 RFC 3339 文本
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/store/storetest"
+)
+
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.TicketStore {
+		return open(t, filepath.Join(t.TempDir(), "tickets.db"))
+	})
+}
+
+func TestStore_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.db")
+	s := open(t, path)
+	ticket := storetest.NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	got, err := open(t, path).GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storetest.AssertEqual(t, got, ticket)
+}
+
+func TestOpen_PathWithURICharacters(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a?b#c %d")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "tickets.db")
+	s := open(t, path)
+	if err := s.SaveTicket(context.Background(), storetest.NewTicket("t1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database not created at %q: %v", path, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "a")); !os.IsNotExist(err) {
+		t.Errorf("path was truncated at '?': Stat() error = %v", err)
+	}
+}
+
+// 多个进程同时打开新数据库时迁移依次执行，每个迁移只应用一次
+func TestMigrations_ConcurrentOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tickets.db")
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := Open(path)
+			if err == nil {
+				s.Close()
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent Open() error = %v", err)
+		}
+	}
+	if v, err := open(t, path).SchemaVersion(context.Background()); err != nil || v != len(migrations) {
+		t.Errorf("SchemaVersion() = %d, %v; want %d", v, err, len(migrations))
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.db")
+	s := open(t, path)
+	if v, err := s.SchemaVersion(ctx); err != nil || v != len(migrations) {
+		t.Fatalf("SchemaVersion() = %d, %v; want %d", v, err, len(migrations))
+	}
+	if err := s.SaveTicket(ctx, storetest.NewTicket("t1")); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// 新版本程序追加的迁移在打开旧数据库时执行，已有数据保留
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]migration(nil), saved...), execSQL(`ALTER TABLE tickets ADD COLUMN labels TEXT NOT NULL DEFAULT ''`))
+	s = open(t, path)
+	if v, err := s.SchemaVersion(ctx); err != nil || v != len(saved)+1 {
+		t.Fatalf("SchemaVersion() after upgrade = %d, %v; want %d", v, err, len(saved)+1)
+	}
+	if _, err := s.GetTicket(ctx, "t1"); err != nil {
+		t.Fatalf("GetTicket() after upgrade error = %v", err)
+	}
+	s.Close()
+
+	// 旧版本程序拒绝打开结构更新的数据库
+	migrations = saved
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("Open() with an older program error = %v, want schema version error", err)
+	}
+}
+
+func TestMigrations_NormalizeTimes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tickets.db")
+
+	// 第 1 版保存的时间保留原始时区偏移，按文本排序与按时间排序不一致
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = saved[:1]
+	s := open(t, path)
+	for _, row := range [][]string{
+		{"t1", "2024-03-01T17:00:00+08:00"}, // 09:00 UTC
+		{"t2", "2024-03-01T10:00:00Z"},
+	} {
+		if _, err := s.db.ExecContext(ctx, `INSERT INTO tickets (id, title, description, type, priority, initial_priority,
+			reassign_count, current_state, workflow_version, version, creator_id, assignee_id, created_at, updated_at, approvals)
+			VALUES (?, '', '', '', 0, 0, 0, 'New', '', 1, '', '', ?, ?, 'null')`, row[0], row[1], row[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	migrations = saved
+	s = open(t, path)
+	page, err := s.ListTickets(ctx, store.Query{Sort: store.SortByCreatedAt, Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tickets) != 2 || page.Tickets[0].ID != "t2" || page.Tickets[1].ID != "t1" {
+		t.Fatalf("ListTickets() = %+v, want t2, t1", page.Tickets)
+	}
+	if want := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC); !page.Tickets[1].CreatedAt.Equal(want) {
+		t.Errorf("t1 CreatedAt = %v, want %v", page.Tickets[1].CreatedAt, want)
+	}
+}
@@ -0,0 +1,177 @@
+package sqlstore
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect 数据库方言：参数占位符、结构迁移以及各数据库语法不同的语句
+type Dialect struct {
+	name string
+	// bindvar 返回第 n 个（从 1 开始）参数的占位符
+	bindvar func(n int) string
+	// insertIgnore 追加在 INSERT 之后，主键已存在时不报错且影响行数为 0，SaveTicket 据此判断版本冲突
+	insertIgnore string
+	// lock 与 unlock 获取、释放迁移用的会话级锁，多个实例同时启动时只有一个执行迁移。
+	// lock 是返回一行一列的查询，结果为 1 表示获得了锁
+	lock, unlock string
+	// zeroTime 与 zeroTimeArg 是查询中代替 NULL 时间（零值时间）的最小时间的 SQL 表达式与参数
+	zeroTime    string
+	zeroTimeArg time.Time
+	// migrations 第 i 个迁移的版本号为 i+1，每个迁移由若干条语句组成
+	migrations [][]string
+}
+
+func (d *Dialect) String() string {
+	return d.name
+}
+
+// rebind 将查询中的 ? 替换为方言的占位符，查询的字符串字面量中不能出现 ?
+func (d *Dialect) rebind(query string) string {
+	if d.bindvar == nil {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.bindvar(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Postgres PostgreSQL 方言，驱动例如 github.com/jackc/pgx/v5/stdlib（驱动名 pgx）
+var Postgres = &Dialect{
+	name:         "postgres",
+	bindvar:      func(n int) string { return "$" + strconv.Itoa(n) },
+	insertIgnore: " ON CONFLICT (id) DO NOTHING",
+	// pg_advisory_lock 一直等待且返回 void，在 FROM 中调用使查询返回 1
+	lock:     "SELECT 1 FROM pg_advisory_lock(72646)",
+	unlock:   "SELECT pg_advisory_unlock(72646)",
+	zeroTime: "'0001-01-01 00:00:00+00'::timestamptz",
+	migrations: [][]string{
+		// 1: 工单、历史与会签投票
+		{
+			`CREATE TABLE tickets (
+				id               VARCHAR(64) PRIMARY KEY,
+				title            TEXT NOT NULL,
+				description      TEXT NOT NULL,
+				type             VARCHAR(64) NOT NULL,
+				priority         INTEGER NOT NULL,
+				initial_priority INTEGER NOT NULL,
+				reassign_count   INTEGER NOT NULL,
+				current_state    VARCHAR(64) NOT NULL,
+				workflow_version VARCHAR(64) NOT NULL,
+				version          BIGINT NOT NULL,
+				creator_id       VARCHAR(64) NOT NULL,
+				assignee_id      VARCHAR(64) NOT NULL,
+				created_at       TIMESTAMPTZ NULL,
+				updated_at       TIMESTAMPTZ NULL
+			)`,
+			`CREATE INDEX tickets_type_state ON tickets (type, current_state)`,
+			`CREATE TABLE ticket_history (
+				ticket_id    VARCHAR(64) NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+				seq          INTEGER NOT NULL,
+				from_state   VARCHAR(64) NOT NULL,
+				to_state     VARCHAR(64) NOT NULL,
+				event        VARCHAR(64) NOT NULL,
+				occurred_at  TIMESTAMPTZ NULL,
+				triggered_by VARCHAR(64) NOT NULL,
+				assignee     VARCHAR(64) NOT NULL,
+				reason       TEXT NOT NULL,
+				comment      TEXT NOT NULL,
+				hold_until   TIMESTAMPTZ NULL,
+				PRIMARY KEY (ticket_id, seq)
+			)`,
+			`CREATE TABLE ticket_approvals (
+				ticket_id  VARCHAR(64) NOT NULL REFERENCES tickets (id) ON DELETE CASCADE,
+				seq        INTEGER NOT NULL,
+				state      VARCHAR(64) NOT NULL,
+				approver   VARCHAR(64) NOT NULL,
+				decision   VARCHAR(16) NOT NULL,
+				comment    TEXT NOT NULL,
+				decided_at TIMESTAMPTZ NULL,
+				PRIMARY KEY (ticket_id, seq)
+			)`,
+		},
+		// 2: 列表查询的过滤条件
+		{
+			`CREATE INDEX tickets_state ON tickets (current_state)`,
+			`CREATE INDEX tickets_assignee ON tickets (assignee_id)`,
+			`CREATE INDEX tickets_creator ON tickets (creator_id)`,
+		},
+	},
+}
+
+// MySQL MySQL 方言，驱动例如 github.com/go-sql-driver/mysql（驱动名 mysql）。
+// DSN 需要 parseTime=true 才能读取时间列，时间按驱动的 loc（默认 UTC）保存；
+// 不能设置 clientFoundRows=true，否则主键已存在的 INSERT 影响行数为 1，重复创建工单不会报告版本冲突
+var MySQL = &Dialect{
+	name:         "mysql",
+	insertIgnore: " ON DUPLICATE KEY UPDATE id = id",
+	// GET_LOCK 超时返回 0，出错返回 NULL
+	lock:   "SELECT GET_LOCK('ticket_schema_migrations', 60)",
+	unlock: "SELECT RELEASE_LOCK('ticket_schema_migrations')",
+	// DATETIME 支持的最小值
+	zeroTime:    "CAST('1000-01-01 00:00:00' AS DATETIME(6))",
+	zeroTimeArg: time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC),
+	migrations: [][]string{
+		// 1: 工单、历史与会签投票
+		{
+			`CREATE TABLE tickets (
+				id               VARCHAR(64) NOT NULL PRIMARY KEY,
+				title            TEXT NOT NULL,
+				description      TEXT NOT NULL,
+				type             VARCHAR(64) NOT NULL,
+				priority         INT NOT NULL,
+				initial_priority INT NOT NULL,
+				reassign_count   INT NOT NULL,
+				current_state    VARCHAR(64) NOT NULL,
+				workflow_version VARCHAR(64) NOT NULL,
+				version          BIGINT NOT NULL,
+				creator_id       VARCHAR(64) NOT NULL,
+				assignee_id      VARCHAR(64) NOT NULL,
+				created_at       DATETIME(6) NULL,
+				updated_at       DATETIME(6) NULL,
+				INDEX tickets_type_state (type, current_state)
+			) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4`,
+			`CREATE TABLE ticket_history (
+				ticket_id    VARCHAR(64) NOT NULL,
+				seq          INT NOT NULL,
+				from_state   VARCHAR(64) NOT NULL,
+				to_state     VARCHAR(64) NOT NULL,
+				event        VARCHAR(64) NOT NULL,
+				occurred_at  DATETIME(6) NULL,
+				triggered_by VARCHAR(64) NOT NULL,
+				assignee     VARCHAR(64) NOT NULL,
+				reason       TEXT NOT NULL,
+				comment      TEXT NOT NULL,
+				hold_until   DATETIME(6) NULL,
+				PRIMARY KEY (ticket_id, seq),
+				FOREIGN KEY (ticket_id) REFERENCES tickets (id) ON DELETE CASCADE
+			) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4`,
+			`CREATE TABLE ticket_approvals (
+				ticket_id  VARCHAR(64) NOT NULL,
+				seq        INT NOT NULL,
+				state      VARCHAR(64) NOT NULL,
+				approver   VARCHAR(64) NOT NULL,
+				decision   VARCHAR(16) NOT NULL,
+				comment    TEXT NOT NULL,
+				decided_at DATETIME(6) NULL,
+				PRIMARY KEY (ticket_id, seq),
+				FOREIGN KEY (ticket_id) REFERENCES tickets (id) ON DELETE CASCADE
+			) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4`,
+		},
+		// 2: 列表查询的过滤条件
+		{
+			`CREATE INDEX tickets_state ON tickets (current_state)`,
+			`CREATE INDEX tickets_assignee ON tickets (assignee_id)`,
+			`CREATE INDEX tickets_creator ON tickets (creator_id)`,
+		},
+	},
+}
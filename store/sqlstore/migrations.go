@@ -0,0 +1,84 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errSchemaLocked 等待迁移锁超时，通常是另一个实例的迁移仍在执行或异常中断
+var errSchemaLocked = errors.New("lock schema: timed out waiting for another migration")
+
+// migrate 在方言的会话锁内依次执行尚未应用的迁移，并在 schema_migrations 中记录版本。
+// PostgreSQL 的每个迁移在一个事务中执行；MySQL 的 DDL 会隐式提交，迁移中途失败需要人工处理。
+// 数据库版本高于程序已知的版本时拒绝打开，避免旧程序写入新结构
+func (s *Store) migrate(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, s.dialect.lock).Scan(&locked); err != nil {
+		return fmt.Errorf("lock schema: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return errSchemaLocked
+	}
+	defer conn.ExecContext(context.Background(), s.dialect.unlock)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER NOT NULL PRIMARY KEY,
+		applied_at VARCHAR(64) NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	migrations := s.dialect.migrations
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, len(migrations))
+	}
+	for i := current; i < len(migrations); i++ {
+		if err := s.apply(ctx, conn, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) apply(ctx context.Context, conn *sql.Conn, version int, stmts []string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := s.exec(ctx, tx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+		version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion 返回数据库已应用的迁移版本
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, s.db)
+}
+
+func schemaVersion(ctx context.Context, q querier) (int, error) {
+	var version int
+	err := q.QueryRowContext(ctx, `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
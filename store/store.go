@@ -3,35 +3,168 @@ package store
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"sync"
 
 	"github.com/kekexiaoai/ticket/model"
 )
 
+var (
+	// ErrTicketNotFound 工单不存在
+	ErrTicketNotFound = errors.New("ticket not found")
+	// ErrVersionConflict 工单在读取后已被其他写入修改
+	ErrVersionConflict = errors.New("ticket version conflict")
+)
+
+// ConflictError 保存的工单版本与存储中的版本不一致
+type ConflictError struct {
+	ID      string
+	Version int64 // 保存的工单携带的版本
+	Stored  int64 // 存储中的当前版本，工单不存在时为 0
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("ticket %s version conflict: saving version %d, stored version %d", e.ID, e.Version, e.Stored)
+}
+
+func (e *ConflictError) Is(target error) bool { return target == ErrVersionConflict }
+
 // TicketStore 定义存储接口
+//
+// SaveTicket 实现乐观锁：ticket.Version 必须等于存储中的版本（新工单为 0），
+// 否则返回 *ConflictError 且不做修改；保存成功后 ticket.Version 加一。
+// 时间精度低于纳秒的存储在保存成功后将 ticket 中的时间截断为保存的精度，
+// 使 ticket 与重新读取的工单相同，调用方（如调度定时器）应以保存后的 ticket 为准。
+// ListTickets 按 Query 过滤、排序并分页，游标无效时返回 ErrInvalidCursor。
 type TicketStore interface {
 	SaveTicket(ctx context.Context, ticket *model.Ticket) error
 	GetTicket(ctx context.Context, id string) (*model.Ticket, error)
+	ListTickets(ctx context.Context, q Query) (*Page, error)
 }
 
-// MockStore 模拟存储
+// Updater 可选接口：支持在事务中锁定工单并读-改-写的存储。
+// UpdateTicket 读取并锁定工单，调用 fn 修改后保存；fn 返回错误时放弃修改并返回该错误，
+// 锁定期间其他实例对同一工单的 UpdateTicket 等待，不会产生版本冲突
+type Updater interface {
+	UpdateTicket(ctx context.Context, id string, fn func(ticket *model.Ticket) error) error
+}
+
+// MockStore 模拟存储，保存与返回的都是工单副本，可在 goroutine 间并发使用。
+// 按状态、处理人、创建人维护二级索引，ListTickets 从最小的候选集合开始过滤
 type MockStore struct {
-	tickets map[string]*model.Ticket
+	mu         sync.RWMutex
+	tickets    map[string]*model.Ticket
+	byState    index
+	byAssignee index
+	byCreator  index
+}
+
+// index 字段值 → 工单 ID 集合
+type index map[string]map[string]bool
+
+func (idx index) add(value, id string) {
+	if idx[value] == nil {
+		idx[value] = make(map[string]bool)
+	}
+	idx[value][id] = true
+}
+
+func (idx index) remove(value, id string) {
+	delete(idx[value], id)
+	if len(idx[value]) == 0 {
+		delete(idx, value)
+	}
 }
 
 func NewMockStore() *MockStore {
-	return &MockStore{tickets: make(map[string]*model.Ticket)}
+	return &MockStore{
+		tickets:    make(map[string]*model.Ticket),
+		byState:    make(index),
+		byAssignee: make(index),
+		byCreator:  make(index),
+	}
 }
 
 func (s *MockStore) SaveTicket(ctx context.Context, ticket *model.Ticket) error {
-	s.tickets[ticket.ID] = ticket
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stored int64
+	if old, ok := s.tickets[ticket.ID]; ok {
+		stored = old.Version
+	}
+	if ticket.Version != stored {
+		return &ConflictError{ID: ticket.ID, Version: ticket.Version, Stored: stored}
+	}
+	if old, ok := s.tickets[ticket.ID]; ok {
+		s.byState.remove(old.CurrentState, old.ID)
+		s.byAssignee.remove(old.AssigneeID, old.ID)
+		s.byCreator.remove(old.CreatorID, old.ID)
+	}
+	ticket.Version++
+	s.tickets[ticket.ID] = ticket.Clone()
+	s.byState.add(ticket.CurrentState, ticket.ID)
+	s.byAssignee.add(ticket.AssigneeID, ticket.ID)
+	s.byCreator.add(ticket.CreatorID, ticket.ID)
 	log.Printf("保存工单: %s, 当前状态: %s, 优先级: %d", ticket.ID, ticket.CurrentState, ticket.Priority)
 	return nil
 }
 
 func (s *MockStore) GetTicket(ctx context.Context, id string) (*model.Ticket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if ticket, ok := s.tickets[id]; ok {
-		return ticket, nil
+		return ticket.Clone(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, id)
+}
+
+// ListTickets 从索引中最小的候选集合开始，过滤、排序并分页
+func (s *MockStore) ListTickets(ctx context.Context, q Query) (*Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// candidates 为 nil 表示没有可用的索引条件，需要遍历全部工单
+	var candidates map[string]bool
+	narrow := func(set map[string]bool) {
+		if set == nil {
+			set = map[string]bool{}
+		}
+		if candidates == nil || len(set) < len(candidates) {
+			candidates = set
+		}
+	}
+	if len(q.States) > 0 {
+		set := make(map[string]bool)
+		for _, state := range q.States {
+			for id := range s.byState[state] {
+				set[id] = true
+			}
+		}
+		narrow(set)
+	}
+	if q.AssigneeID != "" {
+		narrow(s.byAssignee[q.AssigneeID])
+	}
+	if q.CreatorID != "" {
+		narrow(s.byCreator[q.CreatorID])
+	}
+
+	var tickets []*model.Ticket
+	if candidates == nil {
+		for _, ticket := range s.tickets {
+			tickets = append(tickets, ticket)
+		}
+	} else {
+		for id := range candidates {
+			tickets = append(tickets, s.tickets[id])
+		}
+	}
+	page, err := q.Apply(tickets)
+	if err != nil {
+		return nil, err
+	}
+	for i, ticket := range page.Tickets {
+		page.Tickets[i] = ticket.Clone()
 	}
-	return nil, errors.New("ticket not found")
+	return page, nil
 }
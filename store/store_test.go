@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/store/storetest"
+)
+
+func TestMockStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.TicketStore {
+		return store.NewMockStore()
+	})
+}
@@ -0,0 +1,545 @@
+// Package storetest 提供 store.TicketStore 实现的一致性测试，各存储实现在自己的测试中调用 Run
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+	"github.com/kekexiaoai/ticket/store"
+	"github.com/kekexiaoai/ticket/workflow"
+)
+
+// Run 对 newStore 返回的存储执行全部一致性测试，每个子测试使用一个新的空存储。
+// 存储实现了 store.Updater 时同时检查 UpdateTicket
+func Run(t *testing.T, newStore func(t *testing.T) store.TicketStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.TicketStore)
+	}{
+		{"RoundTrip", testRoundTrip},
+		{"NotFound", testNotFound},
+		{"VersionConflict", testVersionConflict},
+		{"Copies", testCopies},
+		{"HistoryGrows", testHistoryGrows},
+		{"HistoryRewrite", testHistoryRewrite},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"Query", testQuery},
+		{"QueryErrors", testQueryErrors},
+		{"Update", testUpdate},
+		{"ConcurrentLockedUpdates", testConcurrentLockedUpdates},
+		{"TimePrecision", testTimePrecision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// created 测试工单的创建时间。PostgreSQL 与 MySQL 只保存到微秒，存储需要至少保留微秒精度
+var created = time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC)
+
+// NewTicket 返回填写了全部字段的新工单，Version 为 0
+func NewTicket(id string) *model.Ticket {
+	return &model.Ticket{
+		ID:              id,
+		Title:           "Printer on fire",
+		Description:     "第三层的打印机",
+		Type:            "incident",
+		Priority:        2,
+		InitialPriority: 1,
+		ReassignCount:   1,
+		CurrentState:    "FinalApproval",
+		WorkflowVersion: "v1",
+		CreatorID:       "user123",
+		AssigneeID:      "user789",
+		CreatedAt:       created,
+		UpdatedAt:       created.Add(time.Hour),
+		History: []model.History{
+			{FromState: "New", ToState: "Pending", Event: "Submit", Timestamp: created, TriggeredBy: "user123"},
+			{FromState: "Pending", ToState: "InitialReview", Event: "Assign", Timestamp: created.Add(time.Minute), TriggeredBy: "user456",
+				Payload: model.Payload{Assignee: "user789", Comment: "紧急", HoldUntil: created.Add(24 * time.Hour)}},
+		},
+		Approvals: []model.Approval{
+			{State: "FinalApproval", Approver: "alice", Decision: model.DecisionApprove, Comment: "ok", Timestamp: created.Add(2 * time.Minute)},
+		},
+	}
+}
+
+// AssertEqual 比较两个工单，时间按时刻比较而不比较时区
+func AssertEqual(t *testing.T, got, want *model.Ticket) {
+	t.Helper()
+	if !reflect.DeepEqual(normalize(got), normalize(want)) {
+		t.Errorf("ticket mismatch\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func normalize(ticket *model.Ticket) *model.Ticket {
+	c := ticket.Clone()
+	c.CreatedAt = c.CreatedAt.UTC()
+	c.UpdatedAt = c.UpdatedAt.UTC()
+	for i := range c.History {
+		c.History[i].Timestamp = c.History[i].Timestamp.UTC()
+		c.History[i].Payload.HoldUntil = c.History[i].Payload.HoldUntil.UTC()
+	}
+	for i := range c.Approvals {
+		c.Approvals[i].Timestamp = c.Approvals[i].Timestamp.UTC()
+	}
+	// 空切片与 nil 视为相同
+	if len(c.History) == 0 {
+		c.History = nil
+	}
+	if len(c.Approvals) == 0 {
+		c.Approvals = nil
+	}
+	return c
+}
+
+func testRoundTrip(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	ticket := NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Version != 1 {
+		t.Errorf("Version after create = %d, want 1", ticket.Version)
+	}
+	got, err := s.GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEqual(t, got, ticket)
+
+	// 没有历史与投票的工单
+	empty := &model.Ticket{ID: "t2", CurrentState: "New"}
+	if err := s.SaveTicket(ctx, empty); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetTicket(ctx, "t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEqual(t, got, empty)
+}
+
+func testNotFound(t *testing.T, s store.TicketStore) {
+	if _, err := s.GetTicket(context.Background(), "missing"); !errors.Is(err, store.ErrTicketNotFound) {
+		t.Errorf("GetTicket(missing) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+func testVersionConflict(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	if err := s.SaveTicket(ctx, NewTicket("t1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个读者读取同一版本，后保存的一方冲突
+	a, _ := s.GetTicket(ctx, "t1")
+	b, _ := s.GetTicket(ctx, "t1")
+	a.Title = "a"
+	b.Title = "b"
+	if err := s.SaveTicket(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	err := s.SaveTicket(ctx, b)
+	var conflict *store.ConflictError
+	if !errors.Is(err, store.ErrVersionConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("stale SaveTicket() error = %v, want ConflictError", err)
+	}
+	if conflict.ID != "t1" || conflict.Version != 1 || conflict.Stored != 2 {
+		t.Errorf("conflict = %+v, want t1 version 1, stored 2", conflict)
+	}
+	if b.Version != 1 {
+		t.Errorf("rejected ticket Version = %d, want unchanged 1", b.Version)
+	}
+
+	// 重复创建同一 ID 的工单与保存不存在的旧版本工单同样冲突
+	if err := s.SaveTicket(ctx, NewTicket("t1")); !errors.Is(err, store.ErrVersionConflict) {
+		t.Errorf("duplicate create error = %v, want ErrVersionConflict", err)
+	}
+	ghost := NewTicket("t2")
+	ghost.Version = 3
+	if err := s.SaveTicket(ctx, ghost); !errors.As(err, &conflict) || conflict.Stored != 0 {
+		t.Errorf("SaveTicket(missing, version 3) error = %v, want conflict with stored version 0", err)
+	}
+	if _, err := s.GetTicket(ctx, "t2"); !errors.Is(err, store.ErrTicketNotFound) {
+		t.Errorf("GetTicket(t2) error = %v, want ErrTicketNotFound", err)
+	}
+
+	got, _ := s.GetTicket(ctx, "t1")
+	if got.Title != "a" || got.Version != 2 {
+		t.Errorf("stored ticket = %q version %d, want \"a\" version 2", got.Title, got.Version)
+	}
+}
+
+func testCopies(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	ticket := NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	// 保存后修改调用方的工单或返回的工单都不影响存储
+	ticket.Title = "changed"
+	ticket.History[0].Event = "changed"
+	got, _ := s.GetTicket(ctx, "t1")
+	got.Title = "changed"
+	got.Approvals[0].Decision = model.DecisionReject
+
+	again, _ := s.GetTicket(ctx, "t1")
+	want := NewTicket("t1")
+	want.Version = 1
+	AssertEqual(t, again, want)
+}
+
+func testHistoryGrows(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	ticket := NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	ticket.History = append(ticket.History, model.History{
+		FromState: "InitialReview", ToState: "Working", Event: "ApproveInitial",
+		Timestamp: created.Add(time.Hour), TriggeredBy: "user456",
+	})
+	ticket.Approvals = nil
+	ticket.CurrentState = "Working"
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, ticket)
+	if got.Version != 2 {
+		t.Errorf("Version = %d, want 2", got.Version)
+	}
+}
+
+// testHistoryRewrite 修改或截短已有的历史条目后保存，读取到的是修改后的历史
+func testHistoryRewrite(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	ticket := NewTicket("t1")
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	ticket.History[0].Payload.Comment = "已更正"
+	ticket.History[0].Timestamp = created.Add(time.Minute)
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, ticket)
+
+	ticket.History = ticket.History[:1]
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, ticket)
+}
+
+// testConcurrentUpdates 多个 goroutine 以读-改-写方式更新同一工单，冲突时重试，更新不会丢失
+func testConcurrentUpdates(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	if err := s.SaveTicket(ctx, &model.Ticket{ID: "t1", CurrentState: "Working"}); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				ticket, err := s.GetTicket(ctx, "t1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ticket.ReassignCount++
+				ticket.History = append(ticket.History, model.History{Event: "Reassign", TriggeredBy: fmt.Sprint("user", i), Timestamp: created})
+				err = s.SaveTicket(ctx, ticket)
+				if errors.Is(err, store.ErrVersionConflict) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, _ := s.GetTicket(ctx, "t1")
+	if got.ReassignCount != n || len(got.History) != n || got.Version != n+1 {
+		t.Errorf("ReassignCount = %d, len(History) = %d, Version = %d; want %d, %d, %d",
+			got.ReassignCount, len(got.History), got.Version, n, n, n+1)
+	}
+}
+
+// queryFixture 保存查询测试用的工单：t5 的时间为零值，t6 的创建时间使用其他时区
+func queryFixture(t *testing.T, s store.TicketStore) {
+	t.Helper()
+	hour := func(n int) time.Time { return created.Add(time.Duration(n) * time.Hour) }
+	tickets := []*model.Ticket{
+		{ID: "t1", CurrentState: "New", AssigneeID: "erin", CreatorID: "alice", Priority: 3, CreatedAt: hour(1), UpdatedAt: hour(1)},
+		{ID: "t2", CurrentState: "InitialReview", AssigneeID: "bob", CreatorID: "carol", Priority: 1, CreatedAt: hour(2), UpdatedAt: hour(2)},
+		{ID: "t3", CurrentState: "InitialReview", AssigneeID: "bob", CreatorID: "alice", Priority: 3, CreatedAt: hour(3), UpdatedAt: hour(4)},
+		{ID: "t4", CurrentState: "InitialReview", AssigneeID: "dave", CreatorID: "alice", Priority: 2, CreatedAt: hour(4), UpdatedAt: hour(6)},
+		{ID: "t5", CurrentState: "New", CreatorID: "carol"},
+		{ID: "t6", CurrentState: "Completed", AssigneeID: "bob", CreatorID: "alice", Priority: 2,
+			CreatedAt: hour(0).In(time.FixedZone("CST", 8*3600)), UpdatedAt: hour(1)},
+	}
+	for _, ticket := range tickets {
+		if err := s.SaveTicket(context.Background(), ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已保存的工单再次更新后，旧的状态与处理人不再能查到
+	t1, _ := s.GetTicket(context.Background(), "t1")
+	t1.CurrentState = "Working"
+	t1.AssigneeID = "bob"
+	t1.UpdatedAt = hour(5)
+	if err := s.SaveTicket(context.Background(), t1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// list 执行查询并返回工单 ID，Limit 不为 0 时逐页读取直到最后一页
+func list(t *testing.T, s store.TicketStore, q store.Query) []string {
+	t.Helper()
+	var ids []string
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("ListTickets(%+v) does not terminate", q)
+		}
+		page, err := s.ListTickets(context.Background(), q)
+		if err != nil {
+			t.Fatalf("ListTickets(%+v) error = %v", q, err)
+		}
+		if q.Limit > 0 && len(page.Tickets) > q.Limit {
+			t.Fatalf("ListTickets(%+v) returned %d tickets, want at most %d", q, len(page.Tickets), q.Limit)
+		}
+		for _, ticket := range page.Tickets {
+			ids = append(ids, ticket.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func testQuery(t *testing.T, s store.TicketStore) {
+	queryFixture(t, s)
+	hour := func(n int) time.Time { return created.Add(time.Duration(n) * time.Hour) }
+	priority := func(n int) *int { return &n }
+	var inProgress []string
+	for _, state := range workflow.NewStateMachine().LeafStates(workflow.StateInProgress) {
+		inProgress = append(inProgress, string(state))
+	}
+	tests := []struct {
+		name string
+		q    store.Query
+		want []string
+	}{
+		{"all", store.Query{}, []string{"t1", "t2", "t3", "t4", "t5", "t6"}},
+		{"state and assignee", store.Query{States: []string{"InitialReview"}, AssigneeID: "bob"}, []string{"t2", "t3"}},
+		{"states", store.Query{States: []string{"InitialReview", "New"}}, []string{"t2", "t3", "t4", "t5"}},
+		{"unknown state", store.Query{States: []string{"Closed"}}, nil},
+		{"composite state", store.Query{States: []string{"InProgress"}}, nil}, // 不展开复合状态
+		{"composite state leaves", store.Query{States: inProgress}, []string{"t1"}},
+		{"previous assignee", store.Query{AssigneeID: "erin"}, nil},
+		{"creator", store.Query{CreatorID: "alice"}, []string{"t1", "t3", "t4", "t6"}},
+		{"creator and unknown assignee", store.Query{CreatorID: "alice", AssigneeID: "nobody"}, nil},
+		{"min priority", store.Query{MinPriority: priority(2)}, []string{"t1", "t3", "t4", "t6"}},
+		{"max priority", store.Query{MaxPriority: priority(1)}, []string{"t2", "t5"}},
+		{"max priority zero", store.Query{MaxPriority: priority(0)}, []string{"t5"}},
+		{"priority range", store.Query{MinPriority: priority(2), MaxPriority: priority(2)}, []string{"t4", "t6"}},
+		{"created range", store.Query{Created: store.TimeRange{From: hour(2), To: hour(4)}}, []string{"t2", "t3"}},
+		{"created before", store.Query{Created: store.TimeRange{To: hour(1)}}, []string{"t5", "t6"}},
+		{"updated since", store.Query{Updated: store.TimeRange{From: hour(4)}}, []string{"t1", "t3", "t4"}},
+		{"my reviews by priority", store.Query{States: []string{"InitialReview"}, AssigneeID: "bob", Sort: store.SortByPriority, Desc: true}, []string{"t3", "t2"}},
+		{"id desc", store.Query{Desc: true}, []string{"t6", "t5", "t4", "t3", "t2", "t1"}},
+		{"priority", store.Query{Sort: store.SortByPriority}, []string{"t5", "t2", "t4", "t6", "t1", "t3"}},
+		{"priority desc", store.Query{Sort: store.SortByPriority, Desc: true}, []string{"t3", "t1", "t6", "t4", "t2", "t5"}},
+		{"created", store.Query{Sort: store.SortByCreatedAt}, []string{"t5", "t6", "t1", "t2", "t3", "t4"}},
+		{"updated desc", store.Query{Sort: store.SortByUpdatedAt, Desc: true}, []string{"t4", "t1", "t3", "t2", "t6", "t5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := list(t, s, tt.q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListTickets() = %v, want %v", got, tt.want)
+			}
+			// 分页读取的结果与一次读取相同
+			for _, limit := range []int{1, 2, 4} {
+				q := tt.q
+				q.Limit = limit
+				if got := list(t, s, q); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ListTickets() with limit %d = %v, want %v", limit, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// 返回完整的工单
+	page, err := s.ListTickets(context.Background(), store.Query{States: []string{"New"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tickets) != 1 || page.Tickets[0].CreatorID != "carol" || page.Tickets[0].Version != 1 {
+		t.Errorf("ListTickets(New) = %+v, want t5 created by carol at version 1", page.Tickets)
+	}
+}
+
+func testQueryErrors(t *testing.T, s store.TicketStore) {
+	queryFixture(t, s)
+	ctx := context.Background()
+	page, err := s.ListTickets(ctx, store.Query{Sort: store.SortByPriority, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("NextCursor is empty, want a cursor for the second page")
+	}
+	tests := []struct {
+		name string
+		q    store.Query
+	}{
+		{"garbage cursor", store.Query{Cursor: "not a cursor"}},
+		{"cursor for another sort", store.Query{Sort: store.SortByCreatedAt, Cursor: page.NextCursor}},
+		{"cursor for another direction", store.Query{Sort: store.SortByPriority, Desc: true, Cursor: page.NextCursor}},
+	}
+	for _, tt := range tests {
+		if _, err := s.ListTickets(ctx, tt.q); !errors.Is(err, store.ErrInvalidCursor) {
+			t.Errorf("%s: ListTickets() error = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+	if _, err := s.ListTickets(ctx, store.Query{Sort: "title"}); err == nil {
+		t.Error("ListTickets() with an unknown sort key succeeded, want error")
+	}
+}
+
+func testUpdate(t *testing.T, s store.TicketStore) {
+	updater, ok := s.(store.Updater)
+	if !ok {
+		t.Skip("store does not implement store.Updater")
+	}
+	ctx := context.Background()
+	if err := s.SaveTicket(ctx, NewTicket("t1")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := NewTicket("t1")
+	want.CurrentState = "Completed"
+	want.History = append(want.History, model.History{FromState: "FinalApproval", ToState: "Completed", Event: "ApproveFinal", Timestamp: created, TriggeredBy: "admin"})
+	want.Approvals = nil
+	want.Version = 2
+	err := updater.UpdateTicket(ctx, "t1", func(ticket *model.Ticket) error {
+		ticket.CurrentState = want.CurrentState
+		ticket.History = want.History
+		ticket.Approvals = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, want)
+
+	// fn 返回错误时放弃修改
+	rejected := errors.New("rejected")
+	err = updater.UpdateTicket(ctx, "t1", func(ticket *model.Ticket) error {
+		ticket.CurrentState = "Canceled"
+		return rejected
+	})
+	if !errors.Is(err, rejected) {
+		t.Errorf("UpdateTicket() error = %v, want the error returned by fn", err)
+	}
+	got, _ = s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, want)
+
+	if err := updater.UpdateTicket(ctx, "missing", func(*model.Ticket) error { return nil }); !errors.Is(err, store.ErrTicketNotFound) {
+		t.Errorf("UpdateTicket(missing) error = %v, want ErrTicketNotFound", err)
+	}
+}
+
+// testConcurrentLockedUpdates UpdateTicket 锁定工单，并发更新不需要重试也不会丢失
+func testConcurrentLockedUpdates(t *testing.T, s store.TicketStore) {
+	updater, ok := s.(store.Updater)
+	if !ok {
+		t.Skip("store does not implement store.Updater")
+	}
+	ctx := context.Background()
+	if err := s.SaveTicket(ctx, &model.Ticket{ID: "t1", CurrentState: "Working"}); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := updater.UpdateTicket(ctx, "t1", func(ticket *model.Ticket) error {
+				ticket.ReassignCount++
+				ticket.History = append(ticket.History, model.History{Event: "Reassign", TriggeredBy: fmt.Sprint("user", i), Timestamp: created})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, _ := s.GetTicket(ctx, "t1")
+	if got.ReassignCount != n || len(got.History) != n || got.Version != n+1 {
+		t.Errorf("ReassignCount = %d, len(History) = %d, Version = %d; want %d, %d, %d",
+			got.ReassignCount, len(got.History), got.Version, n, n, n+1)
+	}
+}
+
+// testTimePrecision 以 time.Now() 的纳秒时间保存工单：保存后的 ticket 与重新读取的工单相同。
+// 服务按保存后的 ticket 调度定时器，重新读取后以 Equal 比较进入状态的时间
+func testTimePrecision(t *testing.T, s store.TicketStore) {
+	ctx := context.Background()
+	now := time.Now()
+	ticket := NewTicket("t1")
+	ticket.CreatedAt, ticket.UpdatedAt = now, now
+	for i := range ticket.History {
+		ticket.History[i].Timestamp = now
+	}
+	ticket.History[1].Payload.HoldUntil = now.Add(time.Hour)
+	ticket.Approvals[0].Timestamp = now
+	if err := s.SaveTicket(ctx, ticket); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTicket(ctx, "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEqual(t, got, ticket)
+
+	updater, ok := s.(store.Updater)
+	if !ok {
+		return
+	}
+	var saved *model.Ticket
+	err = updater.UpdateTicket(ctx, "t1", func(ticket *model.Ticket) error {
+		ticket.UpdatedAt = time.Now()
+		ticket.History = append(ticket.History, model.History{FromState: "FinalApproval", ToState: "Completed", Event: "ApproveFinal", Timestamp: ticket.UpdatedAt})
+		saved = ticket
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.GetTicket(ctx, "t1")
+	AssertEqual(t, got, saved)
+}
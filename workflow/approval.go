@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+// ApprovalGroup 一组审批人，Required 为需要的通过票数，为 0 时要求组内全部通过
+type ApprovalGroup struct {
+	Name      string
+	Approvers []string
+	Required  int
+}
+
+func (g ApprovalGroup) required() int {
+	if g.Required <= 0 {
+		return len(g.Approvers)
+	}
+	return g.Required
+}
+
+func (g ApprovalGroup) has(actor string) bool {
+	for _, a := range g.Approvers {
+		if a == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalSet 会签规则：每个组都达到通过票数后 Approve 事件才会离开状态，
+// 之前的 Approve 只记录投票；任意一次 Reject 立即按 Reject 事件的转换离开状态。
+// N 选 M 使用一个 Required 为 N 的组，"这些组都要同意" 使用多个组。
+type ApprovalSet struct {
+	Approve Event
+	Reject  Event
+	Groups  []ApprovalGroup
+}
+
+func (s *ApprovalSet) member(actor string) bool {
+	for _, g := range s.Groups {
+		if g.has(actor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfied 判断 votes 中的通过票是否满足所有组
+func (s *ApprovalSet) Satisfied(votes []model.Approval) bool {
+	for _, g := range s.Groups {
+		n := 0
+		for _, v := range votes {
+			if v.Decision == model.DecisionApprove && g.has(v.Approver) {
+				n++
+			}
+		}
+		if n < g.required() {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterApprovals 将 state 设为会签状态，set.Approve 与 set.Reject（可为空）必须是 state 上已有的转换
+func (sm *StateMachine) RegisterApprovals(state State, set ApprovalSet) error {
+	if sm.frozen {
+		return ErrFrozen
+	}
+	events := []Event{set.Approve}
+	if set.Reject != "" {
+		events = append(events, set.Reject)
+	}
+	for _, event := range events {
+		if _, ok := sm.transitions[state][event]; !ok {
+			return &InvalidTransitionError{From: state, Event: event}
+		}
+	}
+	sm.node(state).Approval = &set
+	return nil
+}
+
+// Approvals 返回工单在会签状态 state 上本轮的投票
+func Approvals(ticket *model.Ticket, state State) []model.Approval {
+	var votes []model.Approval
+	for _, v := range ticket.Approvals {
+		if v.State == string(state) {
+			votes = append(votes, v)
+		}
+	}
+	return votes
+}
+
+// approvalFor 返回转换边所在状态的会签规则，event 不是投票事件时返回 nil
+func (sm *StateMachine) approvalFor(edge *Edge) *ApprovalSet {
+	node, ok := sm.nodes[edge.From]
+	if !ok || node.Approval == nil {
+		return nil
+	}
+	if set := node.Approval; edge.Event == set.Approve || edge.Event == set.Reject {
+		return set
+	}
+	return nil
+}
+
+// checkVote 检查 actor 是否为审批人且本轮尚未投票
+func (sm *StateMachine) checkVote(ticket *model.Ticket, edge *Edge, set *ApprovalSet, actor string) error {
+	var err error
+	switch {
+	case !set.member(actor):
+		err = ErrNotApprover
+	default:
+		for _, v := range Approvals(ticket, edge.From) {
+			if v.Approver == actor {
+				err = ErrAlreadyVoted
+				break
+			}
+		}
+	}
+	if err != nil {
+		return &ForbiddenError{Actor: actor, State: edge.From, Event: edge.Event, Err: err}
+	}
+	return nil
+}
+
+// vote 记录 actor 的投票，返回会签是否已经可以离开状态
+func (sm *StateMachine) vote(ticket *model.Ticket, edge *Edge, set *ApprovalSet, actor string, payload model.Payload) bool {
+	decision := model.DecisionApprove
+	if edge.Event == set.Reject {
+		decision = model.DecisionReject
+	}
+	comment := payload.Comment
+	if comment == "" {
+		comment = payload.Reason
+	}
+	ticket.Approvals = append(ticket.Approvals, model.Approval{
+		State:     string(edge.From),
+		Approver:  actor,
+		Decision:  decision,
+		Comment:   comment,
+		Timestamp: time.Now(),
+	})
+	return decision == model.DecisionReject || set.Satisfied(Approvals(ticket, edge.From))
+}
+
+// clearApprovals 进入会签状态时开始新一轮投票
+func (sm *StateMachine) clearApprovals(ticket *model.Ticket, enters []State) {
+	for _, s := range enters {
+		if node, ok := sm.nodes[s]; ok && node.Approval != nil {
+			var kept []model.Approval
+			for _, v := range ticket.Approvals {
+				if v.State != string(s) {
+					kept = append(kept, v)
+				}
+			}
+			ticket.Approvals = kept
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func newApprovalMachine(t *testing.T) *StateMachine {
+	t.Helper()
+	sm := NewStateMachine()
+	var notified int
+	err := sm.RegisterTransitionTasks(StateFinalApproval, EventApproveFinal, nil, []Task{{Name: "Notify", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+		notified++
+		if notified > 1 {
+			return errors.New("notified more than once")
+		}
+		return nil
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.RegisterApprovals(StateFinalApproval, ApprovalSet{
+		Approve: EventApproveFinal,
+		Reject:  EventRejectFinal,
+		Groups: []ApprovalGroup{
+			{Name: "dev", Approvers: []string{"alice", "bob", "carol"}, Required: 2},
+			{Name: "ops", Approvers: []string{"dave"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+func TestStateMachine_Approvals(t *testing.T) {
+	sm := newApprovalMachine(t)
+	ctx := context.Background()
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateFinalApproval), CreatedAt: time.Now()}
+
+	for _, actor := range []string{"alice", "dave"} {
+		got, err := sm.Transition(ctx, ticket, EventApproveFinal, actor, model.Payload{Comment: "lgtm"})
+		if err != nil {
+			t.Fatalf("Transition(%s) error = %v", actor, err)
+		}
+		if got != StateFinalApproval {
+			t.Fatalf("Transition(%s) = %v, want %v before quorum", actor, got, StateFinalApproval)
+		}
+	}
+
+	if _, err := sm.Transition(ctx, ticket, EventApproveFinal, "alice", model.Payload{}); !errors.Is(err, ErrAlreadyVoted) || !errors.Is(err, ErrForbidden) {
+		t.Errorf("second vote error = %v, want ErrAlreadyVoted", err)
+	}
+	if _, err := sm.Transition(ctx, ticket, EventApproveFinal, "mallory", model.Payload{}); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("outsider vote error = %v, want ErrNotApprover", err)
+	}
+	if got := sm.AvailableEvents(ctx, ticket, "alice"); got != nil {
+		t.Errorf("AvailableEvents(alice) = %v, want none after voting", got)
+	}
+	if got := sm.AvailableEvents(ctx, ticket, "bob"); !reflect.DeepEqual(got, []Event{EventApproveFinal, EventRejectFinal}) {
+		t.Errorf("AvailableEvents(bob) = %v, want [ApproveFinal RejectFinal]", got)
+	}
+
+	got, err := sm.Transition(ctx, ticket, EventApproveFinal, "bob", model.Payload{})
+	if err != nil || got != StateCompleted {
+		t.Fatalf("Transition(bob) = %v, %v, want %v", got, err, StateCompleted)
+	}
+
+	var voters []string
+	for _, v := range ticket.Approvals {
+		voters = append(voters, v.Approver+":"+v.Decision)
+	}
+	if want := []string{"alice:approve", "dave:approve", "bob:approve"}; !reflect.DeepEqual(voters, want) {
+		t.Errorf("Approvals = %v, want %v", voters, want)
+	}
+	if len(ticket.History) != 3 {
+		t.Fatalf("len(History) = %d, want one entry per vote", len(ticket.History))
+	}
+	if h := ticket.History[0]; h.FromState != h.ToState || h.TriggeredBy != "alice" || h.Payload.Comment != "lgtm" {
+		t.Errorf("History[0] = %+v, want alice's vote recorded in FinalApproval", h)
+	}
+}
+
+func TestStateMachine_ApprovalReject(t *testing.T) {
+	sm := newApprovalMachine(t)
+	ctx := context.Background()
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateFinalApproval), CreatedAt: time.Now()}
+
+	if _, err := sm.Transition(ctx, ticket, EventApproveFinal, "alice", model.Payload{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sm.Transition(ctx, ticket, EventRejectFinal, "carol", model.Payload{Reason: "missing tests"})
+	if err != nil || got != StateWorking {
+		t.Fatalf("Transition(RejectFinal) = %v, %v, want %v", got, err, StateWorking)
+	}
+	if last := ticket.Approvals[len(ticket.Approvals)-1]; last.Decision != model.DecisionReject || last.Comment != "missing tests" {
+		t.Errorf("last vote = %+v, want carol's rejection", last)
+	}
+
+	// 重新提交后开始新一轮投票
+	for _, event := range []Event{EventSubmitFinal, EventClaimFinal} {
+		if _, err := sm.Transition(ctx, ticket, event, "alice", model.Payload{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ticket.Approvals) != 0 {
+		t.Errorf("Approvals = %+v, want empty after re-entering FinalApproval", ticket.Approvals)
+	}
+	if _, err := sm.Transition(ctx, ticket, EventApproveFinal, "alice", model.Payload{}); err != nil {
+		t.Errorf("alice vote in new round error = %v", err)
+	}
+}
+
+func TestStateMachine_RegisterApprovalsUnknownEvent(t *testing.T) {
+	sm := NewStateMachine()
+	err := sm.RegisterApprovals(StateWorking, ApprovalSet{Approve: EventApproveFinal, Groups: []ApprovalGroup{{Approvers: []string{"alice"}}}})
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("RegisterApprovals() error = %v, want ErrInvalidTransition", err)
+	}
+}
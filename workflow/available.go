@@ -0,0 +1,57 @@
+package workflow
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+// CanTransition 检查 actor 能否对工单触发 event，依次检查权限、会签投票资格与 Guard。
+// 节点与转换边上的 Guard 以试运行模式在工单副本上执行（payload 为空），不会修改工单，也不会执行其他任务。
+func (sm *StateMachine) CanTransition(ctx context.Context, ticket *model.Ticket, event Event, actor string) error {
+	current := sm.resolve(State(ticket.CurrentState))
+	edge, _, ok := sm.lookup(current, event)
+	if !ok {
+		return &InvalidTransitionError{From: current, Event: event}
+	}
+
+	ctx = withDryRun(WithActor(ctx, actor))
+	if err := sm.authorize(ctx, ticket, edge, actor); err != nil {
+		return err
+	}
+	if approval := sm.approvalFor(edge); approval != nil {
+		if err := sm.checkVote(ticket, edge, approval, actor); err != nil {
+			return err
+		}
+	}
+	probe := ticket.Clone()
+	guards := append(sm.tasks(sm.ancestry(current), func(n *Node) []Task { return n.Guards }), edge.Guards...)
+	for _, guard := range guards {
+		if err := guard.Execute(ctx, probe, event, model.Payload{}); err != nil {
+			return &GuardRejectedError{Task: guard.Name, State: current, Event: event, Err: err}
+		}
+	}
+	return nil
+}
+
+// AvailableEvents 返回 actor 当前可以对工单触发的事件，按名称排序
+func (sm *StateMachine) AvailableEvents(ctx context.Context, ticket *model.Ticket, actor string) []Event {
+	current := sm.resolve(State(ticket.CurrentState))
+	seen := make(map[Event]bool)
+	var events []Event
+	for _, s := range sm.ancestry(current) {
+		for event := range sm.transitions[s] {
+			// 内层状态的转换覆盖外层同名事件
+			if seen[event] {
+				continue
+			}
+			seen[event] = true
+			if sm.CanTransition(ctx, ticket, event, actor) == nil {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+	return events
+}
@@ -0,0 +1,61 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func TestStateMachine_AvailableEvents(t *testing.T) {
+	sm := NewStateMachine()
+	var dryRun bool
+	err := sm.RegisterTransitionTasks(StateWorking, EventSubmitFinal,
+		[]Task{{Name: "OnlyAlice", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			dryRun = IsDryRun(ctx)
+			ticket.Priority = 99 // 试运行中的修改不应影响原工单
+			if ActorFromContext(ctx) != "alice" {
+				return errors.New("only alice can submit")
+			}
+			return nil
+		}}},
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateWorking), Priority: 1, CreatedAt: time.Now()}
+	tests := []struct {
+		actor string
+		want  []Event
+	}{
+		{"alice", []Event{EventHold, EventReassign, EventSubmitFinal}},
+		{"bob", []Event{EventHold, EventReassign}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.actor, func(t *testing.T) {
+			got := sm.AvailableEvents(context.Background(), ticket, tt.actor)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AvailableEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !dryRun {
+		t.Error("Guard was not run in dry-run mode")
+	}
+	if ticket.Priority != 1 || ticket.CurrentState != string(StateWorking) {
+		t.Errorf("ticket modified by dry run: %+v", ticket)
+	}
+
+	if err := sm.CanTransition(context.Background(), ticket, EventArchive, "alice"); err == nil {
+		t.Error("CanTransition(Archive) = nil, want invalid transition")
+	}
+	ticket.CurrentState = string(StateOnHold)
+	if got := sm.AvailableEvents(context.Background(), ticket, "alice"); !reflect.DeepEqual(got, []Event{EventResume}) {
+		t.Errorf("AvailableEvents(OnHold) = %v, want [Resume]", got)
+	}
+}
@@ -0,0 +1,241 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Builder 以链式调用构建不可修改的状态机，例如：
+//
+//	sm, err := workflow.NewBuilder().
+//		State(StateNew).On(EventSubmit).GoTo(StatePending).
+//		State(StatePending).On(EventAssign).GoTo(StateInitialReview).Guard(requireApprover).Action(notify).
+//		State(StateInitialReview).Terminal().
+//		Build()
+//
+// 第一个声明的状态为初始状态，可用 Initial 修改。GoTo 的目标状态未声明时自动声明。
+// 构建出的状态机经过 Validate 检查，不能再注册任务或修改，可以在 goroutine 间共享。
+type Builder struct {
+	initial State
+	order   []State
+	nodes   map[State]*Node
+	edges   []*Edge
+}
+
+func NewBuilder() *Builder {
+	return &Builder{nodes: make(map[State]*Node)}
+}
+
+// Initial 设置新工单的初始状态
+func (b *Builder) Initial(state State) *Builder {
+	b.initial = state
+	return b
+}
+
+// State 声明状态并开始配置它，重复调用时继续配置同一个状态
+func (b *Builder) State(state State) *StateBuilder {
+	return &StateBuilder{Builder: b, node: b.declare(state)}
+}
+
+func (b *Builder) declare(state State) *Node {
+	node, ok := b.nodes[state]
+	if !ok {
+		node = &Node{State: state}
+		b.nodes[state] = node
+		b.order = append(b.order, state)
+	}
+	return node
+}
+
+// Build 检查并返回不可修改的状态机。配置错误与 Validate 发现的问题一并返回
+func (b *Builder) Build() (*StateMachine, error) {
+	var errs []error
+	errorf := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("workflow builder: "+format, args...))
+	}
+	if len(b.order) == 0 {
+		return nil, errors.New("workflow builder: no states declared")
+	}
+	initial := b.initial
+	if initial == "" {
+		initial = b.order[0]
+	}
+	if _, ok := b.nodes[initial]; !ok {
+		errorf("initial state %s is not declared", initial)
+	}
+	for _, state := range b.order {
+		node := b.nodes[state]
+		if node.Parent != "" {
+			if _, ok := b.nodes[node.Parent]; !ok {
+				errorf("parent %s of %s is not declared", node.Parent, state)
+			}
+		}
+		// 祖先链成环时 resolve 与 ancestry 不会结束，必须在 Validate 之前发现
+		for p, depth := node.Parent, 0; p != ""; depth++ {
+			if p == state || depth > len(b.order) {
+				errorf("state %s is its own ancestor", state)
+				break
+			}
+			parent, ok := b.nodes[p]
+			if !ok {
+				break
+			}
+			p = parent.Parent
+		}
+		if child, ok := b.nodes[node.Initial]; node.Initial != "" && (!ok || child.Parent != state) {
+			errorf("initial state %s is not a child of %s", node.Initial, state)
+		}
+	}
+
+	// 复制节点与转换，构建后继续使用 Builder 不会影响已构建的状态机
+	sm := newStateMachine(initial)
+	for state, node := range b.nodes {
+		n := *node
+		n.BeforeTasks = append([]Task(nil), node.BeforeTasks...)
+		n.AfterTasks = append([]Task(nil), node.AfterTasks...)
+		n.OnEnter = append([]Task(nil), node.OnEnter...)
+		n.OnExit = append([]Task(nil), node.OnExit...)
+		n.Guards = append([]Task(nil), node.Guards...)
+		n.Timers = append([]Timer(nil), node.Timers...)
+		n.Approval = nil
+		sm.nodes[state] = &n
+	}
+	for _, e := range b.edges {
+		edge := &Edge{From: e.From, Event: e.Event, To: e.To,
+			Guards:  append([]Task(nil), e.Guards...),
+			Actions: append([]Task(nil), e.Actions...),
+		}
+		if edge.To == "" {
+			errorf("transition from %s on %s has no target, call GoTo", edge.From, edge.Event)
+			continue
+		}
+		if _, ok := sm.transitions[edge.From][edge.Event]; ok {
+			errorf("duplicate transition from %s on %s", edge.From, edge.Event)
+			continue
+		}
+		if sm.transitions[edge.From] == nil {
+			sm.transitions[edge.From] = make(map[Event]*Edge)
+		}
+		sm.transitions[edge.From][edge.Event] = edge
+		sm.events[edge.Event] = true
+	}
+	for _, state := range b.order {
+		if set := b.nodes[state].Approval; set != nil {
+			if err := sm.RegisterApprovals(state, *set); err != nil {
+				errorf("approval in %s: %v", state, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err := sm.Validate(); err != nil {
+		return nil, err
+	}
+	sm.Freeze()
+	return sm, nil
+}
+
+// MustBuild 与 Build 相同，出错时 panic，适用于测试与包级变量
+func (b *Builder) MustBuild() *StateMachine {
+	sm, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return sm
+}
+
+// StateBuilder 配置一个状态，同时可以继续调用 Builder 的方法
+type StateBuilder struct {
+	*Builder
+	node *Node
+}
+
+// Parent 将状态设为复合状态 parent 的子状态
+func (s *StateBuilder) Parent(parent State) *StateBuilder {
+	s.node.Parent = parent
+	return s
+}
+
+// InitialChild 设置复合状态的初始子状态
+func (s *StateBuilder) InitialChild(child State) *StateBuilder {
+	s.node.Initial = child
+	return s
+}
+
+// Terminal 标记为终止状态
+func (s *StateBuilder) Terminal() *StateBuilder {
+	s.node.Terminal = true
+	return s
+}
+
+func (s *StateBuilder) Before(tasks ...Task) *StateBuilder {
+	s.node.BeforeTasks = append(s.node.BeforeTasks, tasks...)
+	return s
+}
+
+func (s *StateBuilder) After(tasks ...Task) *StateBuilder {
+	s.node.AfterTasks = append(s.node.AfterTasks, tasks...)
+	return s
+}
+
+func (s *StateBuilder) OnEnter(tasks ...Task) *StateBuilder {
+	s.node.OnEnter = append(s.node.OnEnter, tasks...)
+	return s
+}
+
+func (s *StateBuilder) OnExit(tasks ...Task) *StateBuilder {
+	s.node.OnExit = append(s.node.OnExit, tasks...)
+	return s
+}
+
+// Guard 添加节点 Guard，检查从该状态（及其子状态）出发的所有转换
+func (s *StateBuilder) Guard(tasks ...Task) *StateBuilder {
+	s.node.Guards = append(s.node.Guards, tasks...)
+	return s
+}
+
+// Timer 添加定时器，在进入状态 after 之后触发 event
+func (s *StateBuilder) Timer(name string, after time.Duration, event Event) *StateBuilder {
+	s.node.Timers = append(s.node.Timers, Timer{Name: name, After: after, Event: event})
+	return s
+}
+
+// Approval 将状态设为会签状态，见 RegisterApprovals
+func (s *StateBuilder) Approval(set ApprovalSet) *StateBuilder {
+	s.node.Approval = &set
+	return s
+}
+
+// On 开始配置从该状态出发、由 event 触发的转换
+func (s *StateBuilder) On(event Event) *TransitionBuilder {
+	edge := &Edge{From: s.node.State, Event: event}
+	s.edges = append(s.edges, edge)
+	return &TransitionBuilder{StateBuilder: s, edge: edge}
+}
+
+// TransitionBuilder 配置一条转换，同时可以继续配置来源状态或声明其他状态
+type TransitionBuilder struct {
+	*StateBuilder
+	edge *Edge
+}
+
+// GoTo 设置目标状态，未声明的状态会被自动声明
+func (t *TransitionBuilder) GoTo(to State) *TransitionBuilder {
+	t.edge.To = to
+	t.declare(to)
+	return t
+}
+
+// Guard 添加只检查这条转换的 Guard
+func (t *TransitionBuilder) Guard(tasks ...Task) *TransitionBuilder {
+	t.edge.Guards = append(t.edge.Guards, tasks...)
+	return t
+}
+
+// Action 添加在状态更新后、OnEnter 之前执行的任务
+func (t *TransitionBuilder) Action(tasks ...Task) *TransitionBuilder {
+	t.edge.Actions = append(t.edge.Actions, tasks...)
+	return t
+}
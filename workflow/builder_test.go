@@ -0,0 +1,138 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func TestBuilder(t *testing.T) {
+	var actions int
+	var mu sync.Mutex
+	requireComment := Task{Name: "RequireComment", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+		if payload.Comment == "" {
+			return errors.New("comment required")
+		}
+		return nil
+	}}
+	count := Task{Name: "Count", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+		mu.Lock()
+		defer mu.Unlock()
+		actions++
+		return nil
+	}}
+
+	sm, err := NewBuilder().
+		State("Draft").On("Submit").GoTo("Review").
+		State("Review").On("Approve").GoTo("Done").Guard(requireComment).Action(count).
+		On("Reject").GoTo("Draft").
+		State("Done").Terminal().
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if sm.InitialState() != "Draft" || !sm.Frozen() {
+		t.Errorf("InitialState() = %s, Frozen() = %v, want Draft, true", sm.InitialState(), sm.Frozen())
+	}
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: "Draft", CreatedAt: time.Now()}
+	if _, err := sm.Transition(context.Background(), ticket, "Submit", "alice", model.Payload{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Transition(context.Background(), ticket, "Approve", "alice", model.Payload{}); !errors.Is(err, ErrGuardRejected) {
+		t.Errorf("Approve without comment error = %v, want ErrGuardRejected", err)
+	}
+	if got, err := sm.Transition(context.Background(), ticket, "Approve", "alice", model.Payload{Comment: "ok"}); err != nil || got != "Done" {
+		t.Errorf("Approve = %v, %v, want Done", got, err)
+	}
+	if actions != 1 {
+		t.Errorf("actions = %d, want 1", actions)
+	}
+
+	// 不同 goroutine 共享同一个状态机
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ticket := &model.Ticket{ID: fmt.Sprintf("ticket-%d", i), CurrentState: "Review", CreatedAt: time.Now()}
+			if _, err := sm.Transition(context.Background(), ticket, "Approve", "alice", model.Payload{Comment: "ok"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if actions != 21 {
+		t.Errorf("actions = %d, want 21", actions)
+	}
+}
+
+func TestBuilder_Frozen(t *testing.T) {
+	b := NewBuilder().
+		State("Open").On("Close").GoTo("Closed").
+		State("Closed").Terminal()
+	sm := b.MustBuild()
+
+	if err := sm.RegisterTransitionTasks("Open", "Close", nil, nil); !errors.Is(err, ErrFrozen) {
+		t.Errorf("RegisterTransitionTasks() error = %v, want ErrFrozen", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrFrozen {
+				t.Errorf("RegisterTasks() panic = %v, want ErrFrozen", r)
+			}
+		}()
+		sm.RegisterTasks("Open", nil, nil, nil, nil, nil)
+	}()
+
+	// 构建后继续修改 Builder 不影响已构建的状态机
+	b.State("Closed").OnEnter(Task{Name: "Late", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+		return errors.New("should not run")
+	}})
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: "Open"}
+	if _, err := sm.Transition(context.Background(), ticket, "Close", "alice", model.Payload{}); err != nil {
+		t.Errorf("Transition() error = %v", err)
+	}
+
+	withAuth := sm.WithAuthorizer(denyAll{})
+	ticket.CurrentState = "Open"
+	if _, err := withAuth.Transition(context.Background(), ticket, "Close", "alice", model.Payload{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("WithAuthorizer Transition() error = %v, want ErrForbidden", err)
+	}
+	if _, err := sm.Transition(context.Background(), ticket, "Close", "alice", model.Payload{}); err != nil {
+		t.Errorf("original machine gained the authorizer: %v", err)
+	}
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		want    error
+	}{
+		{"missing GoTo", NewBuilder().State("Open").On("Close").State("Closed").Terminal().Builder, nil},
+		{"duplicate transition", NewBuilder().State("Open").On("Close").GoTo("Closed").On("Close").GoTo("Open").State("Closed").Terminal().Builder, nil},
+		{"unknown initial", NewBuilder().Initial("Draft").State("Open").Terminal().Builder, nil},
+		{"initial is not a child", NewBuilder().State("InProgress").InitialChild("Working").State("Working").Terminal().Builder, nil},
+		{"parent cycle", NewBuilder().State("Open").Terminal().State("A").Parent("B").InitialChild("B").State("B").Parent("A").InitialChild("A").Builder, nil},
+		{"own parent", NewBuilder().State("Open").Parent("Open").InitialChild("Open").Terminal().Builder, nil},
+		{"dead end", NewBuilder().State("Open").On("Close").GoTo("Closed").Builder, ErrInvalidWorkflow},
+		{"unreachable", NewBuilder().State("Open").Terminal().State("Orphan").Terminal().Builder, ErrInvalidWorkflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := tt.builder.Build()
+			if err == nil {
+				t.Fatalf("Build() = %v, want error", sm)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Build() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
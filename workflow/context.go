@@ -0,0 +1,32 @@
+package workflow
+
+import "context"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	dryRunKey
+)
+
+// WithActor 返回携带操作人的 context，任务可通过 ActorFromContext 读取
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext 返回触发当前转换的操作人，未设置时为空
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// IsDryRun 判断 Guard 是否在 CanTransition/AvailableEvents 的试运行中执行，
+// 有副作用或依赖实际请求数据的 Guard 可据此跳过
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey).(bool)
+	return dryRun
+}
+
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey, true)
+}
@@ -0,0 +1,613 @@
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Definition 声明式工作流定义，可从 YAML 或 JSON 文档加载
+type Definition struct {
+	Name        string
+	Version     string // 版本，注册到 Registry 时与 Name 一起标识状态机
+	Initial     State
+	States      []StateDefinition
+	Events      []Event
+	Transitions []TransitionDefinition
+
+	initialLine int
+	eventLines  []int
+}
+
+// StateDefinition 描述一个状态以及挂载在各阶段的任务名称
+type StateDefinition struct {
+	Name     State
+	Parent   State // 所属的复合状态
+	Initial  State // 复合状态的初始子状态
+	Before   []TaskRef
+	After    []TaskRef
+	OnEnter  []TaskRef
+	OnExit   []TaskRef
+	Guards   []TaskRef
+	Timers   []TimerDefinition
+	Approval *ApprovalDefinition // 会签规则，可为空
+	Terminal bool                // 终止状态
+	Line     int
+}
+
+// ApprovalDefinition 描述会签状态的投票事件与审批组
+type ApprovalDefinition struct {
+	Approve Event
+	Reject  Event
+	Groups  []ApprovalGroup
+	Line    int
+}
+
+// TimerDefinition 描述状态上的定时器，After 使用 time.ParseDuration 格式，如 "336h"
+type TimerDefinition struct {
+	Name  string
+	After time.Duration
+	Event Event
+	Line  int
+}
+
+// TransitionDefinition 描述一条状态转换
+type TransitionDefinition struct {
+	From    State
+	Event   Event
+	To      State
+	Guards  []TaskRef
+	Actions []TaskRef
+	Line    int
+}
+
+// TaskRef 按名称引用 TaskRegistry 中的任务
+type TaskRef struct {
+	Name string
+	Line int
+}
+
+// TaskRegistry 按名称索引任务，供声明式定义引用
+type TaskRegistry map[string]Task
+
+// NewTaskRegistry 以 Task.Name 为键构建任务注册表
+func NewTaskRegistry(tasks ...Task) TaskRegistry {
+	r := make(TaskRegistry, len(tasks))
+	for _, task := range tasks {
+		r[task.Name] = task
+	}
+	return r
+}
+
+// DefinitionError 定义文档中的错误，Line 为出错的行号（未知时为 0）
+type DefinitionError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *DefinitionError) Error() string {
+	prefix := "workflow definition"
+	if e.File != "" {
+		prefix = e.File
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s: line %d: %s", prefix, e.Line, e.Msg)
+	}
+	return prefix + ": " + e.Msg
+}
+
+func definitionErrorf(line int, format string, args ...any) *DefinitionError {
+	return &DefinitionError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// LoadDefinition 从文件加载工作流定义
+func LoadDefinition(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def, err := ParseDefinition(data)
+	if derr, ok := err.(*DefinitionError); ok {
+		derr.File = path
+	}
+	return def, err
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// ParseDefinition 解析 YAML 或 JSON 格式的工作流定义并校验
+func ParseDefinition(data []byte) (*Definition, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, definitionErrorf(line, "%s", m[2])
+		}
+		return nil, definitionErrorf(0, "%v", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, definitionErrorf(0, "empty document")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, definitionErrorf(root.Line, "expected a mapping at top level")
+	}
+
+	def := &Definition{}
+	err := eachField(root, func(key, val *yaml.Node) error {
+		var err error
+		switch key.Value {
+		case "name":
+			def.Name, err = scalar(val)
+		case "version":
+			def.Version, err = scalar(val)
+		case "initial":
+			var s string
+			s, err = scalar(val)
+			def.Initial, def.initialLine = State(s), val.Line
+		case "events":
+			var names []string
+			names, err = stringList(val)
+			for i, n := range names {
+				def.Events = append(def.Events, Event(n))
+				def.eventLines = append(def.eventLines, val.Content[i].Line)
+			}
+		case "states":
+			def.States, err = parseStates(val)
+		case "transitions":
+			def.Transitions, err = parseTransitions(val)
+		default:
+			err = definitionErrorf(key.Line, "unknown field %q", key.Value)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func parseStates(node *yaml.Node) ([]StateDefinition, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, definitionErrorf(node.Line, "states: expected a list")
+	}
+	states := make([]StateDefinition, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, definitionErrorf(item.Line, "state: expected a mapping")
+		}
+		st := StateDefinition{Line: item.Line}
+		err := eachField(item, func(key, val *yaml.Node) error {
+			var err error
+			switch key.Value {
+			case "name":
+				var s string
+				s, err = scalar(val)
+				st.Name = State(s)
+			case "parent":
+				var s string
+				s, err = scalar(val)
+				st.Parent = State(s)
+			case "initial":
+				var s string
+				s, err = scalar(val)
+				st.Initial = State(s)
+			case "before":
+				st.Before, err = taskRefs(val)
+			case "after":
+				st.After, err = taskRefs(val)
+			case "on_enter":
+				st.OnEnter, err = taskRefs(val)
+			case "on_exit":
+				st.OnExit, err = taskRefs(val)
+			case "guards":
+				st.Guards, err = taskRefs(val)
+			case "timers":
+				st.Timers, err = parseTimers(val)
+			case "approval":
+				st.Approval, err = parseApproval(val)
+			case "terminal":
+				if val.Kind != yaml.ScalarNode || (val.Value != "true" && val.Value != "false") {
+					return definitionErrorf(val.Line, "state: terminal must be true or false")
+				}
+				st.Terminal = val.Value == "true"
+			default:
+				err = definitionErrorf(key.Line, "state: unknown field %q", key.Value)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+func parseTimers(node *yaml.Node) ([]TimerDefinition, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, definitionErrorf(node.Line, "timers: expected a list")
+	}
+	timers := make([]TimerDefinition, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, definitionErrorf(item.Line, "timer: expected a mapping")
+		}
+		timer := TimerDefinition{Line: item.Line}
+		err := eachField(item, func(key, val *yaml.Node) error {
+			s, err := scalar(val)
+			if err != nil {
+				return err
+			}
+			switch key.Value {
+			case "name":
+				timer.Name = s
+			case "after":
+				timer.After, err = time.ParseDuration(s)
+				if err != nil {
+					return definitionErrorf(val.Line, "timer: invalid duration %q", s)
+				}
+			case "event":
+				timer.Event = Event(s)
+			default:
+				return definitionErrorf(key.Line, "timer: unknown field %q", key.Value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		timers = append(timers, timer)
+	}
+	return timers, nil
+}
+
+func parseApproval(node *yaml.Node) (*ApprovalDefinition, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, definitionErrorf(node.Line, "approval: expected a mapping")
+	}
+	approval := &ApprovalDefinition{Line: node.Line}
+	err := eachField(node, func(key, val *yaml.Node) error {
+		var err error
+		var s string
+		switch key.Value {
+		case "approve":
+			s, err = scalar(val)
+			approval.Approve = Event(s)
+		case "reject":
+			s, err = scalar(val)
+			approval.Reject = Event(s)
+		case "groups":
+			approval.Groups, err = parseApprovalGroups(val)
+		default:
+			err = definitionErrorf(key.Line, "approval: unknown field %q", key.Value)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+func parseApprovalGroups(node *yaml.Node) ([]ApprovalGroup, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, definitionErrorf(node.Line, "groups: expected a list")
+	}
+	groups := make([]ApprovalGroup, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, definitionErrorf(item.Line, "group: expected a mapping")
+		}
+		var g ApprovalGroup
+		err := eachField(item, func(key, val *yaml.Node) error {
+			switch key.Value {
+			case "name":
+				s, err := scalar(val)
+				g.Name = s
+				return err
+			case "approvers":
+				var err error
+				g.Approvers, err = stringList(val)
+				return err
+			case "required":
+				s, err := scalar(val)
+				if err != nil {
+					return err
+				}
+				if g.Required, err = strconv.Atoi(s); err != nil || g.Required < 0 {
+					return definitionErrorf(val.Line, "group: invalid required %q", s)
+				}
+				return nil
+			default:
+				return definitionErrorf(key.Line, "group: unknown field %q", key.Value)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(g.Approvers) == 0 || g.Required > len(g.Approvers) {
+			return nil, definitionErrorf(item.Line, "group %q requires approvers and at most %d required", g.Name, len(g.Approvers))
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func parseTransitions(node *yaml.Node) ([]TransitionDefinition, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, definitionErrorf(node.Line, "transitions: expected a list")
+	}
+	transitions := make([]TransitionDefinition, 0, len(node.Content))
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, definitionErrorf(item.Line, "transition: expected a mapping")
+		}
+		tr := TransitionDefinition{Line: item.Line}
+		err := eachField(item, func(key, val *yaml.Node) error {
+			var err error
+			var s string
+			switch key.Value {
+			case "from":
+				s, err = scalar(val)
+				tr.From = State(s)
+			case "event":
+				s, err = scalar(val)
+				tr.Event = Event(s)
+			case "to":
+				s, err = scalar(val)
+				tr.To = State(s)
+			case "guards":
+				tr.Guards, err = taskRefs(val)
+			case "actions":
+				tr.Actions, err = taskRefs(val)
+			default:
+				err = definitionErrorf(key.Line, "transition: unknown field %q", key.Value)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, tr)
+	}
+	return transitions, nil
+}
+
+// eachField 按顺序遍历映射的键值对。yaml.Node 不检查重复的键，重复时报错，否则后一个会悄悄覆盖前一个
+func eachField(node *yaml.Node, fn func(key, val *yaml.Node) error) error {
+	seen := make(map[string]int, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if line, ok := seen[key.Value]; ok {
+			return definitionErrorf(key.Line, "duplicate field %q, first defined at line %d", key.Value, line)
+		}
+		seen[key.Value] = key.Line
+		if err := fn(key, node.Content[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scalar(node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", definitionErrorf(node.Line, "expected a string")
+	}
+	return node.Value, nil
+}
+
+// stringList 解析字符串列表，第 i 个元素的行号为 node.Content[i].Line
+func stringList(node *yaml.Node) ([]string, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, definitionErrorf(node.Line, "expected a list")
+	}
+	values := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		s, err := scalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// taskRefs 解析任务名称列表，记录行号供解析任务时报错
+func taskRefs(node *yaml.Node) ([]TaskRef, error) {
+	names, err := stringList(node)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]TaskRef, len(names))
+	for i, name := range names {
+		refs[i] = TaskRef{Name: name, Line: node.Content[i].Line}
+	}
+	return refs, nil
+}
+
+// Validate 校验定义内部的一致性：状态、事件与转换之间的引用
+func (d *Definition) Validate() error {
+	if len(d.States) == 0 {
+		return definitionErrorf(0, "no states defined")
+	}
+	states := make(map[State]bool, len(d.States))
+	for _, st := range d.States {
+		if st.Name == "" {
+			return definitionErrorf(st.Line, "state name is required")
+		}
+		if states[st.Name] {
+			return definitionErrorf(st.Line, "duplicate state %q", st.Name)
+		}
+		states[st.Name] = true
+	}
+	parents := make(map[State]State, len(d.States))
+	composite := make(map[State]bool)
+	for _, st := range d.States {
+		if st.Parent == "" {
+			continue
+		}
+		if !states[st.Parent] {
+			return definitionErrorf(st.Line, "unknown parent state %q", st.Parent)
+		}
+		parents[st.Name] = st.Parent
+		composite[st.Parent] = true
+	}
+	for _, st := range d.States {
+		for p, depth := st.Parent, 0; p != ""; p, depth = parents[p], depth+1 {
+			if p == st.Name || depth > len(d.States) {
+				return definitionErrorf(st.Line, "state %q is its own ancestor", st.Name)
+			}
+		}
+		// 进入复合状态时必须能确定进入哪个子状态，否则工单会停在非叶子状态
+		if composite[st.Name] && st.Initial == "" {
+			return definitionErrorf(st.Line, "composite state %q requires an initial child state", st.Name)
+		}
+		if st.Initial != "" && parents[st.Initial] != st.Name {
+			return definitionErrorf(st.Line, "initial state %q is not a child of %q", st.Initial, st.Name)
+		}
+	}
+	if d.Initial != "" && !states[d.Initial] {
+		return definitionErrorf(d.initialLine, "initial state %q is not defined", d.Initial)
+	}
+
+	var events map[Event]bool
+	if len(d.Events) > 0 {
+		events = make(map[Event]bool, len(d.Events))
+		for i, e := range d.Events {
+			if events[e] {
+				return definitionErrorf(d.eventLine(i), "duplicate event %q", e)
+			}
+			events[e] = true
+		}
+	}
+
+	for _, st := range d.States {
+		for _, timer := range st.Timers {
+			switch {
+			case timer.Name == "" || timer.Event == "" || timer.After <= 0:
+				return definitionErrorf(timer.Line, "timer requires name, a positive after and event")
+			case events != nil && !events[timer.Event]:
+				return definitionErrorf(timer.Line, "unknown event %q", timer.Event)
+			}
+		}
+	}
+
+	seen := make(map[State]map[Event]bool)
+	for _, tr := range d.Transitions {
+		switch {
+		case tr.From == "" || tr.Event == "" || tr.To == "":
+			return definitionErrorf(tr.Line, "transition requires from, event and to")
+		case !states[tr.From]:
+			return definitionErrorf(tr.Line, "unknown state %q", tr.From)
+		case !states[tr.To]:
+			return definitionErrorf(tr.Line, "unknown state %q", tr.To)
+		case events != nil && !events[tr.Event]:
+			return definitionErrorf(tr.Line, "unknown event %q", tr.Event)
+		case seen[tr.From][tr.Event]:
+			return definitionErrorf(tr.Line, "duplicate transition from %q on %q", tr.From, tr.Event)
+		}
+		if seen[tr.From] == nil {
+			seen[tr.From] = make(map[Event]bool)
+		}
+		seen[tr.From][tr.Event] = true
+	}
+
+	for _, st := range d.States {
+		a := st.Approval
+		if a == nil {
+			continue
+		}
+		switch {
+		case a.Approve == "" || len(a.Groups) == 0:
+			return definitionErrorf(a.Line, "approval requires approve and groups")
+		case !seen[st.Name][a.Approve]:
+			return definitionErrorf(a.Line, "no transition from %q on %q", st.Name, a.Approve)
+		case a.Reject != "" && !seen[st.Name][a.Reject]:
+			return definitionErrorf(a.Line, "no transition from %q on %q", st.Name, a.Reject)
+		}
+	}
+	return nil
+}
+
+func (d *Definition) eventLine(i int) int {
+	if i < len(d.eventLines) {
+		return d.eventLines[i]
+	}
+	return 0
+}
+
+// NewStateMachineFromDefinition 根据定义构建状态机，任务名称从 tasks 中解析
+func NewStateMachineFromDefinition(def *Definition, tasks TaskRegistry) (*StateMachine, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	initial := def.Initial
+	if initial == "" {
+		initial = def.States[0].Name
+	}
+	sm := newStateMachine(initial)
+	for _, st := range def.States {
+		sm.nodes[st.Name] = &Node{State: st.Name, Parent: st.Parent, Initial: st.Initial, Terminal: st.Terminal}
+	}
+	for _, tr := range def.Transitions {
+		sm.addTransition(tr.From, tr.Event, tr.To)
+	}
+	sm.RegisterEvents(def.Events...)
+
+	for _, st := range def.States {
+		var phases [5][]Task
+		for i, refs := range [][]TaskRef{st.Before, st.After, st.OnEnter, st.OnExit, st.Guards} {
+			resolved, err := resolveTasks(refs, tasks)
+			if err != nil {
+				return nil, err
+			}
+			phases[i] = resolved
+		}
+		sm.RegisterTasks(st.Name, phases[0], phases[1], phases[2], phases[3], phases[4])
+		for _, timer := range st.Timers {
+			sm.RegisterTimers(st.Name, Timer{Name: timer.Name, After: timer.After, Event: timer.Event})
+		}
+	}
+	for _, st := range def.States {
+		if a := st.Approval; a != nil {
+			if err := sm.RegisterApprovals(st.Name, ApprovalSet{Approve: a.Approve, Reject: a.Reject, Groups: a.Groups}); err != nil {
+				return nil, definitionErrorf(a.Line, "%v", err)
+			}
+		}
+	}
+	for _, tr := range def.Transitions {
+		guards, err := resolveTasks(tr.Guards, tasks)
+		if err != nil {
+			return nil, err
+		}
+		actions, err := resolveTasks(tr.Actions, tasks)
+		if err != nil {
+			return nil, err
+		}
+		if err := sm.RegisterTransitionTasks(tr.From, tr.Event, guards, actions); err != nil {
+			return nil, definitionErrorf(tr.Line, "%v", err)
+		}
+	}
+	return sm, nil
+}
+
+func resolveTasks(refs []TaskRef, tasks TaskRegistry) ([]Task, error) {
+	resolved := make([]Task, 0, len(refs))
+	for _, ref := range refs {
+		task, ok := tasks[ref.Name]
+		if !ok {
+			return nil, definitionErrorf(ref.Line, "unknown task %q", ref.Name)
+		}
+		resolved = append(resolved, task)
+	}
+	return resolved, nil
+}
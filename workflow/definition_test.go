@@ -0,0 +1,149 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func TestLoadDefinition_JSON(t *testing.T) {
+	def, err := LoadDefinition("testdata/simple.json")
+	if err != nil {
+		t.Fatalf("LoadDefinition() error = %v", err)
+	}
+
+	var guardCalled, onEnterCalled bool
+	tasks := NewTaskRegistry(
+		Task{Name: "Guard", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			guardCalled = true
+			return nil
+		}},
+		Task{Name: "OnEnter", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			onEnterCalled = true
+			return nil
+		}},
+	)
+	sm, err := NewStateMachineFromDefinition(def, tasks)
+	if err != nil {
+		t.Fatalf("NewStateMachineFromDefinition() error = %v", err)
+	}
+	if sm.InitialState() != StateNew {
+		t.Errorf("InitialState() = %v, want %v", sm.InitialState(), StateNew)
+	}
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(sm.InitialState()), CreatedAt: time.Now()}
+	for _, event := range []Event{EventSubmit, EventArchive} {
+		if _, err := sm.Transition(context.Background(), ticket, event, "user123", model.Payload{}); err != nil {
+			t.Fatalf("Transition(%s) error = %v", event, err)
+		}
+	}
+	if ticket.CurrentState != string(StateClosed) {
+		t.Errorf("Ticket.CurrentState = %v, want %v", ticket.CurrentState, StateClosed)
+	}
+	if !guardCalled || !onEnterCalled {
+		t.Errorf("guardCalled = %v, onEnterCalled = %v, want both true", guardCalled, onEnterCalled)
+	}
+	if _, err := sm.Transition(context.Background(), ticket, EventSubmit, "user123", model.Payload{}); err == nil {
+		t.Error("Expected invalid transition error, got nil")
+	}
+}
+
+func TestParseDefinition_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		wantLine int
+	}{
+		{"unknown top-level field", "name: x\nstate:\n  - name: New\n", 2},
+		{"unknown state field", "states:\n  - name: New\n    on_entry: [A]\n", 3},
+		{"duplicate state", "states:\n  - name: New\n  - name: New\n", 3},
+		{"unknown target state", "states:\n  - name: New\ntransitions:\n  - {from: New, event: Submit, to: Pendng}\n", 4},
+		{"undeclared event", "events: [Submit]\nstates:\n  - name: New\ntransitions:\n  - {from: New, event: Cancel, to: New}\n", 5},
+		{"duplicate transition", "states:\n  - name: New\ntransitions:\n  - {from: New, event: Submit, to: New}\n  - {from: New, event: Submit, to: New}\n", 5},
+		{"missing event", "states:\n  - name: New\ntransitions:\n  - from: New\n    to: New\n", 4},
+		{"not a list", "states: New\n", 1},
+		{"unknown parent state", "states:\n  - name: New\n  - name: Working\n    parent: InProgress\n", 3},
+		{"initial is not a child", "states:\n  - name: InProgress\n    initial: New\n  - name: New\n", 2},
+		{"composite without initial", "states:\n  - name: New\n  - name: InProgress\n  - name: Working\n    parent: InProgress\n", 3},
+		{"unknown initial state", "initial: Draft\nstates:\n  - name: New\n", 1},
+		{"duplicate event", "events:\n  - Submit\n  - Submit\nstates:\n  - name: New\n", 3},
+		{"invalid timer duration", "states:\n  - name: New\n    timers:\n      - {name: T, after: 2days, event: Submit}\n", 4},
+		{"timer missing event", "states:\n  - name: New\n    timers:\n      - name: T\n        after: 1h\n", 4},
+		{"approval without transition", "states:\n  - name: New\n    approval:\n      approve: Submit\n      groups: [{approvers: [a]}]\n", 4},
+		{"approval required too high", "states:\n  - name: New\n    approval:\n      approve: Submit\n      groups:\n        - {approvers: [a], required: 2}\n", 6},
+		{"duplicate states field", "states:\n  - name: New\ntransitions: []\nstates:\n  - name: Done\n", 4},
+		{"duplicate events field", "events: [Submit]\nevents: [Cancel]\nstates:\n  - name: New\n", 2},
+		{"duplicate transitions field", "states:\n  - name: New\ntransitions:\n  - {from: New, event: Submit, to: New}\ntransitions: []\n", 5},
+		{"duplicate state field", "states:\n  - name: New\n    name: Old\n", 3},
+		{"duplicate transition field", "states:\n  - name: New\ntransitions:\n  - {from: New, event: Submit, to: New, to: Old}\n", 4},
+		{"syntax error", "name: x\nstates:\n  - name: New\n    a: b: c\n", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDefinition([]byte(tt.doc))
+			var derr *DefinitionError
+			if !errors.As(err, &derr) {
+				t.Fatalf("ParseDefinition() error = %v, want *DefinitionError", err)
+			}
+			if derr.Line != tt.wantLine {
+				t.Errorf("DefinitionError.Line = %d, want %d (%v)", derr.Line, tt.wantLine, err)
+			}
+		})
+	}
+}
+
+func TestNewStateMachineFromDefinition_UnknownTask(t *testing.T) {
+	def, err := ParseDefinition([]byte("states:\n  - name: New\n    guards:\n      - Missing\n"))
+	if err != nil {
+		t.Fatalf("ParseDefinition() error = %v", err)
+	}
+	_, err = NewStateMachineFromDefinition(def, NewTaskRegistry())
+	var derr *DefinitionError
+	if !errors.As(err, &derr) || derr.Line != 4 {
+		t.Errorf("NewStateMachineFromDefinition() error = %v, want unknown task at line 4", err)
+	}
+}
+
+func TestParseDefinition_Approval(t *testing.T) {
+	doc := `
+states:
+  - name: Review
+    approval:
+      approve: Approve
+      reject: Reject
+      groups:
+        - name: dev
+          approvers: [alice, bob]
+          required: 1
+        - name: ops
+          approvers: [dave]
+  - name: Done
+  - name: Draft
+transitions:
+  - {from: Review, event: Approve, to: Done}
+  - {from: Review, event: Reject, to: Draft}
+`
+	def, err := ParseDefinition([]byte(doc))
+	if err != nil {
+		t.Fatalf("ParseDefinition() error = %v", err)
+	}
+	sm, err := NewStateMachineFromDefinition(def, NewTaskRegistry())
+	if err != nil {
+		t.Fatalf("NewStateMachineFromDefinition() error = %v", err)
+	}
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: "Review", CreatedAt: time.Now()}
+	for _, step := range []struct {
+		actor string
+		want  State
+	}{{"bob", "Review"}, {"dave", "Done"}} {
+		got, err := sm.Transition(context.Background(), ticket, "Approve", step.actor, model.Payload{})
+		if err != nil || got != step.want {
+			t.Fatalf("Transition(%s) = %v, %v, want %v", step.actor, got, err, step.want)
+		}
+	}
+}
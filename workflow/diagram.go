@@ -0,0 +1,413 @@
+package workflow
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+// DiagramFormat 状态图的输出格式
+type DiagramFormat string
+
+const (
+	FormatMermaid  DiagramFormat = "mermaid"  // Mermaid stateDiagram-v2
+	FormatPlantUML DiagramFormat = "plantuml" // PlantUML 状态图
+	FormatDOT      DiagramFormat = "dot"      // Graphviz DOT
+)
+
+// ParseDiagramFormat 解析格式名称
+func ParseDiagramFormat(s string) (DiagramFormat, error) {
+	switch f := DiagramFormat(strings.ToLower(s)); f {
+	case FormatMermaid, FormatPlantUML, FormatDOT:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown diagram format %q (want mermaid, plantuml or dot)", s)
+}
+
+// DiagramOptions 控制状态图中的附加信息
+type DiagramOptions struct {
+	Guards bool // 在转换边上标注 Guard 名称，包括来源状态及其祖先上的节点 Guard
+	Tasks  bool // 在状态上列出各阶段任务，在转换边上标注 Action
+	// Ticket 不为空时高亮工单经过的状态与转换，并按 History 顺序为转换编号，
+	// 同一条转换经过多次时依次列出每次的序号（例如 FinalApproval 与 InProgress 之间往返）
+	Ticket *model.Ticket
+}
+
+// diagram 渲染前的中间表示，三种格式共用
+type diagram struct {
+	format    DiagramFormat
+	initial   State
+	children  map[State][]State // 复合状态的子状态，"" 为顶层
+	nodes     map[State]*Node
+	tasks     bool
+	edges     map[State][]diagramEdge // 按所在的复合状态分组，"" 为顶层
+	terminals []State
+	visited   map[State]bool // 工单经过的状态，包括其祖先
+	current   State          // 工单的当前状态
+}
+
+type diagramEdge struct {
+	from, to State
+	label    string
+	steps    []int // 工单经过该转换时的序号
+}
+
+// WriteDiagram 将状态机的转换表与已注册的任务导出为状态图
+func (sm *StateMachine) WriteDiagram(w io.Writer, format DiagramFormat, opts DiagramOptions) error {
+	d := sm.diagram(opts)
+	d.format = format
+	switch format {
+	case FormatMermaid:
+		return d.writeMermaid(w)
+	case FormatPlantUML:
+		return d.writePlantUML(w)
+	case FormatDOT:
+		return d.writeDOT(w)
+	}
+	return fmt.Errorf("unknown diagram format %q", format)
+}
+
+func (sm *StateMachine) diagram(opts DiagramOptions) *diagram {
+	d := &diagram{
+		initial:  sm.initial,
+		children: make(map[State][]State),
+		nodes:    sm.nodes,
+		tasks:    opts.Tasks,
+		edges:    make(map[State][]diagramEdge),
+	}
+	steps := make(map[*Edge][]int)
+	if opts.Ticket != nil {
+		steps = sm.ticketPath(opts.Ticket, d)
+	}
+	for _, state := range sm.States() {
+		d.children[sm.nodes[state].Parent] = append(d.children[sm.nodes[state].Parent], state)
+	}
+
+	for _, from := range sm.States() {
+		events := make([]Event, 0, len(sm.transitions[from]))
+		for event := range sm.transitions[from] {
+			events = append(events, event)
+		}
+		if sm.nodes[from].Terminal || len(events) == 0 && len(d.children[from]) == 0 {
+			d.terminals = append(d.terminals, from)
+		}
+		sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+		for _, event := range events {
+			edge := sm.transitions[from][event]
+			scope := sm.scope(edge.From, edge.To)
+			label, n := sm.edgeLabel(edge, opts), steps[edge]
+			if len(n) > 0 {
+				label = "(" + joinInts(n) + ") " + label
+			}
+			d.edges[scope] = append(d.edges[scope], diagramEdge{from: edge.From, to: edge.To, label: label, steps: n})
+		}
+	}
+	return d
+}
+
+// ticketPath 按 History 找出工单经过的转换及其序号，并记录经过的状态。
+// 会签中未离开状态的投票和迁移等不对应转换的记录不编号。
+func (sm *StateMachine) ticketPath(ticket *model.Ticket, d *diagram) map[*Edge][]int {
+	d.visited = make(map[State]bool)
+	visit := func(state State) {
+		for _, s := range sm.ancestry(sm.resolve(state)) {
+			d.visited[s] = true
+		}
+	}
+	d.current = sm.resolve(State(ticket.CurrentState))
+	visit(d.current)
+
+	steps := make(map[*Edge][]int)
+	step := 0
+	for _, h := range ticket.History {
+		from, to := sm.resolve(State(h.FromState)), sm.resolve(State(h.ToState))
+		visit(from)
+		visit(to)
+		edge, next, ok := sm.lookup(from, Event(h.Event))
+		if !ok || next != to {
+			continue
+		}
+		step++
+		steps[edge] = append(steps[edge], step)
+	}
+	return steps
+}
+
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scope 返回同时严格包含 from 与 to 的最内层复合状态，没有时为 ""
+func (sm *StateMachine) scope(from, to State) State {
+	toChain := sm.ancestry(to)[1:]
+	for _, s := range sm.ancestry(from)[1:] {
+		for _, t := range toChain {
+			if s == t {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// edgeLabel 按 UML 习惯生成 "事件 [Guard] / Action" 形式的标签
+func (sm *StateMachine) edgeLabel(edge *Edge, opts DiagramOptions) string {
+	label := string(edge.Event)
+	if opts.Guards {
+		guards := append(sm.tasks(sm.ancestry(edge.From), func(n *Node) []Task { return n.Guards }), edge.Guards...)
+		if len(guards) > 0 {
+			label += " [" + taskNames(guards) + "]"
+		}
+	}
+	if opts.Tasks && len(edge.Actions) > 0 {
+		label += " / " + taskNames(edge.Actions)
+	}
+	return label
+}
+
+func taskNames(tasks []Task) string {
+	names := make([]string, len(tasks))
+	for i, task := range tasks {
+		names[i] = task.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// taskLines 返回状态上注册的任务，每个阶段一行
+func (d *diagram) taskLines(state State) []string {
+	node, ok := d.nodes[state]
+	if !ok || !d.tasks {
+		return nil
+	}
+	var lines []string
+	for _, phase := range []struct {
+		name  string
+		tasks []Task
+	}{
+		{"before", node.BeforeTasks},
+		{"on_enter", node.OnEnter},
+		{"on_exit", node.OnExit},
+		{"after", node.AfterTasks},
+		{"guards", node.Guards},
+	} {
+		if len(phase.tasks) > 0 {
+			lines = append(lines, phase.name+": "+taskNames(phase.tasks))
+		}
+	}
+	for _, timer := range node.Timers {
+		lines = append(lines, fmt.Sprintf("timer %s: %s after %s", timer.Name, timer.Event, timer.After))
+	}
+	if a := node.Approval; a != nil {
+		lines = append(lines, fmt.Sprintf("approval: %s/%s", a.Approve, a.Reject))
+	}
+	return lines
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var nonIdentRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ident 返回可在 Mermaid 与 PlantUML 中使用的状态标识符
+func ident(state State) string {
+	if identRe.MatchString(string(state)) {
+		return string(state)
+	}
+	return "s_" + nonIdentRe.ReplaceAllString(string(state), "_")
+}
+
+// stateBlock 按复合状态嵌套输出 Mermaid 与 PlantUML 共用的状态声明与转换
+func (d *diagram) stateBlock(b *strings.Builder, parent State, indent string) {
+	if parent != "" {
+		if initial := d.nodes[parent].Initial; initial != "" {
+			fmt.Fprintf(b, "%s[*] --> %s\n", indent, ident(initial))
+		}
+	}
+	for _, state := range d.children[parent] {
+		id := ident(state)
+		if id != string(state) {
+			fmt.Fprintf(b, "%sstate %q as %s\n", indent, state, id)
+		}
+		color := d.plantUMLColor(state)
+		if len(d.children[state]) > 0 {
+			fmt.Fprintf(b, "%sstate %s%s {\n", indent, id, color)
+			d.stateBlock(b, state, indent+"    ")
+			fmt.Fprintf(b, "%s}\n", indent)
+		} else if color != "" {
+			fmt.Fprintf(b, "%sstate %s%s\n", indent, id, color)
+		}
+		for _, line := range d.taskLines(state) {
+			fmt.Fprintf(b, "%s%s : %s\n", indent, id, line)
+		}
+	}
+	for _, e := range d.edges[parent] {
+		arrow := "-->"
+		if len(e.steps) > 0 && d.format == FormatPlantUML {
+			arrow = "-[" + pathColor + ",bold]->"
+		}
+		fmt.Fprintf(b, "%s%s %s %s : %s\n", indent, ident(e.from), arrow, ident(e.to), e.label)
+	}
+}
+
+// 工单路径的高亮颜色
+const (
+	pathColor    = "#D32F2F"
+	visitedColor = "#E3F2FD"
+	currentColor = "#FFE082"
+)
+
+// plantUMLColor 返回 PlantUML 中状态的背景色声明，未高亮时为空
+func (d *diagram) plantUMLColor(state State) string {
+	switch {
+	case d.format != FormatPlantUML:
+		return ""
+	case state == d.current:
+		return " " + currentColor
+	case d.visited[state]:
+		return " " + visitedColor
+	}
+	return ""
+}
+
+func (d *diagram) writeMermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+	d.body(&b, "    ")
+	if d.visited != nil {
+		// Mermaid 状态图不支持单独设置转换边的样式，只高亮状态，转换通过标签中的序号区分
+		fmt.Fprintf(&b, "    classDef visited fill:%s\n", visitedColor)
+		fmt.Fprintf(&b, "    classDef current fill:%s,font-weight:bold\n", currentColor)
+		var visited []string
+		for _, state := range d.sortedVisited() {
+			if state != d.current {
+				visited = append(visited, ident(state))
+			}
+		}
+		if len(visited) > 0 {
+			fmt.Fprintf(&b, "    class %s visited\n", strings.Join(visited, ","))
+		}
+		fmt.Fprintf(&b, "    class %s current\n", ident(d.current))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (d *diagram) writePlantUML(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	d.body(&b, "")
+	b.WriteString("@enduml\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// body 输出 Mermaid 与 PlantUML 共用的主体：初始状态、状态与转换、终止状态
+func (d *diagram) body(b *strings.Builder, indent string) {
+	fmt.Fprintf(b, "%s[*] --> %s\n", indent, ident(d.initial))
+	d.stateBlock(b, "", indent)
+	for _, state := range d.terminals {
+		fmt.Fprintf(b, "%s%s --> [*]\n", indent, ident(state))
+	}
+}
+
+func (d *diagram) sortedVisited() []State {
+	states := make([]State, 0, len(d.visited))
+	for state := range d.visited {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	return states
+}
+
+// leaf 返回 DOT 中代表 state 的节点：复合状态用其初始叶子状态代替
+func (d *diagram) leaf(state State) State {
+	for {
+		node, ok := d.nodes[state]
+		if !ok || node.Initial == "" {
+			return state
+		}
+		state = node.Initial
+	}
+}
+
+func (d *diagram) writeDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph workflow {\n")
+	b.WriteString("    compound=true;\n    rankdir=LR;\n    node [shape=box, style=rounded];\n")
+	b.WriteString("    __start [shape=point];\n")
+	d.dotStates(&b, "", "    ")
+	fmt.Fprintf(&b, "    __start -> %q;\n", d.leaf(d.initial))
+	scopes := make([]State, 0, len(d.edges))
+	for scope := range d.edges {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i] < scopes[j] })
+	for _, scope := range scopes {
+		for _, e := range d.edges[scope] {
+			var attrs []string
+			attrs = append(attrs, fmt.Sprintf("label=%q", e.label))
+			if len(d.children[e.from]) > 0 {
+				attrs = append(attrs, fmt.Sprintf("ltail=%q", "cluster_"+e.from))
+			}
+			if len(d.children[e.to]) > 0 {
+				attrs = append(attrs, fmt.Sprintf("lhead=%q", "cluster_"+e.to))
+			}
+			if len(e.steps) > 0 {
+				attrs = append(attrs, fmt.Sprintf("color=%q, fontcolor=%q, penwidth=2", pathColor, pathColor))
+			}
+			fmt.Fprintf(&b, "    %q -> %q [%s];\n", d.leaf(e.from), d.leaf(e.to), strings.Join(attrs, ", "))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotStates 输出状态节点，复合状态输出为 cluster 子图
+func (d *diagram) dotStates(b *strings.Builder, parent State, indent string) {
+	for _, state := range d.children[parent] {
+		if len(d.children[state]) > 0 {
+			fmt.Fprintf(b, "%ssubgraph %q {\n", indent, "cluster_"+state)
+			fmt.Fprintf(b, "%s    label=%q;\n", indent, d.dotLabel(state))
+			if fill := d.dotFill(state); fill != "" {
+				fmt.Fprintf(b, "%s    style=filled;\n%s    fillcolor=%q;\n", indent, indent, fill)
+			}
+			d.dotStates(b, state, indent+"    ")
+			fmt.Fprintf(b, "%s}\n", indent)
+			continue
+		}
+		attrs := fmt.Sprintf("label=%q", d.dotLabel(state))
+		for _, t := range d.terminals {
+			if t == state {
+				attrs += ", peripheries=2"
+			}
+		}
+		if fill := d.dotFill(state); fill != "" {
+			attrs += fmt.Sprintf(", style=\"rounded,filled\", fillcolor=%q", fill)
+		}
+		fmt.Fprintf(b, "%s%q [%s];\n", indent, state, attrs)
+	}
+}
+
+func (d *diagram) dotLabel(state State) string {
+	return strings.Join(append([]string{string(state)}, d.taskLines(state)...), "\n")
+}
+
+func (d *diagram) dotFill(state State) string {
+	switch {
+	case d.visited == nil:
+		return ""
+	case state == d.current:
+		return currentColor
+	case d.visited[state]:
+		return visitedColor
+	}
+	return ""
+}
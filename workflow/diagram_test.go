@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func TestStateMachine_WriteDiagram(t *testing.T) {
+	sm := NewStateMachine()
+	noop := func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error { return nil }
+	sm.RegisterTasks(StateInProgress, nil, nil, []Task{{Name: "Start", Execute: noop}}, nil, []Task{{Name: "InScope", Execute: noop}})
+	if err := sm.RegisterTransitionTasks(StateFinalApproval, EventRejectFinal, []Task{{Name: "RequireReason", Execute: noop}}, []Task{{Name: "Notify", Execute: noop}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format DiagramFormat
+		opts   DiagramOptions
+		want   []string
+		absent []string
+	}{
+		{FormatMermaid, DiagramOptions{}, []string{
+			"stateDiagram-v2\n",
+			"    [*] --> New\n",
+			"    state InProgress {\n        [*] --> Working\n",
+			"        Working --> Working : Reassign\n",
+			"    FinalApproval --> InProgress : RejectFinal\n",
+			"    Closed --> [*]\n",
+		}, []string{"RequireReason", "Start"}},
+		{FormatPlantUML, DiagramOptions{Guards: true, Tasks: true}, []string{
+			"@startuml\n",
+			"FinalApproval --> InProgress : RejectFinal [RequireReason] / Notify\n",
+			"    Working --> OnHold : Hold [InScope]\n",
+			"InProgress : on_enter: Start\n",
+			"@enduml\n",
+		}, nil},
+		{FormatDOT, DiagramOptions{Guards: true}, []string{
+			"digraph workflow {\n",
+			`subgraph "cluster_InProgress" {`,
+			`"Closed" [label="Closed", peripheries=2];`,
+			`"FinalApproval" -> "Working" [label="RejectFinal [RequireReason]", lhead="cluster_InProgress"];`,
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var b strings.Builder
+			if err := sm.WriteDiagram(&b, tt.format, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("diagram missing %q:\n%s", want, b.String())
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(b.String(), absent) {
+					t.Errorf("diagram contains %q:\n%s", absent, b.String())
+				}
+			}
+		})
+	}
+
+	if _, err := ParseDiagramFormat("svg"); err == nil {
+		t.Error("ParseDiagramFormat(svg) error = nil")
+	}
+}
+
+func TestStateMachine_WriteDiagramTicketPath(t *testing.T) {
+	sm := NewStateMachine()
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateNew)}
+	events := []Event{EventSubmit, EventAssign, EventApproveInitial, EventReassign}
+	for i := 0; i < 3; i++ {
+		events = append(events, EventSubmitFinal, EventClaimFinal, EventRejectFinal)
+	}
+	for _, event := range events {
+		if _, err := sm.Transition(context.Background(), ticket, event, "user123", model.Payload{}); err != nil {
+			t.Fatalf("Transition(%s) error = %v", event, err)
+		}
+	}
+
+	tests := []struct {
+		format DiagramFormat
+		want   []string
+	}{
+		{FormatMermaid, []string{
+			"        Working --> Working : (4) Reassign\n",
+			"        Working --> Submitted : (5, 8, 11) SubmitFinal\n",
+			"    Submitted --> FinalApproval : (6, 9, 12) ClaimFinal\n",
+			"    FinalApproval --> InProgress : (7, 10, 13) RejectFinal\n",
+			"    FinalApproval --> Completed : ApproveFinal\n",
+			"    class Working current\n",
+		}},
+		{FormatPlantUML, []string{
+			"FinalApproval -[#D32F2F,bold]-> InProgress : (7, 10, 13) RejectFinal\n",
+			"FinalApproval --> Completed : ApproveFinal\n",
+			"state FinalApproval #E3F2FD\n",
+		}},
+		{FormatDOT, []string{
+			`"FinalApproval" -> "Working" [label="(7, 10, 13) RejectFinal", lhead="cluster_InProgress", color="#D32F2F"`,
+			`"Working" [label="Working", style="rounded,filled", fillcolor="#FFE082"];`,
+			`"Completed" [label="Completed"];`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var b strings.Builder
+			if err := sm.WriteDiagram(&b, tt.format, DiagramOptions{Ticket: ticket}); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("diagram missing %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
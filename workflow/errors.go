@@ -0,0 +1,129 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 哨兵错误，配合 errors.Is 判断错误类别
+var (
+	ErrInvalidTransition = errors.New("invalid transition")
+	ErrForbidden         = errors.New("forbidden")
+	ErrGuardRejected     = errors.New("guard rejected")
+	ErrTaskFailed        = errors.New("task failed")
+	ErrUnknownWorkflow   = errors.New("unknown workflow")
+	ErrInvalidWorkflow   = errors.New("invalid workflow")
+	ErrFrozen            = errors.New("state machine is frozen")
+)
+
+// ErrPermissionDenied Authorizer 拒绝 actor 时返回的错误（可以包装），
+// 只有它会被转换为 ForbiddenError，其他错误（如策略存储不可用）原样返回
+var ErrPermissionDenied = errors.New("permission denied")
+
+// 会签投票被拒绝的原因，作为 ForbiddenError.Err 返回
+var (
+	ErrNotApprover  = errors.New("not an approver")
+	ErrAlreadyVoted = errors.New("already voted")
+)
+
+// Phase 标识任务执行的阶段
+type Phase string
+
+const (
+	PhaseGuard   Phase = "Guard"
+	PhaseBefore  Phase = "Before"
+	PhaseOnExit  Phase = "OnExit"
+	PhaseAction  Phase = "Action"
+	PhaseOnEnter Phase = "OnEnter"
+	PhaseAfter   Phase = "After"
+)
+
+// InvalidTransitionError 当前状态不接受该事件
+type InvalidTransitionError struct {
+	From  State
+	Event Event
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("invalid transition: %s does not accept %s", e.From, e.Event)
+}
+
+func (e *InvalidTransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// ForbiddenError Authorizer 拒绝了 actor 触发该事件，Err 为 Authorizer 返回的原始错误
+type ForbiddenError struct {
+	Actor string
+	State State
+	Event Event
+	Err   error
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s is not allowed to %s in %s: %v", e.Actor, e.Event, e.State, e.Err)
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return e.Err
+}
+
+// GuardRejectedError Guard 拒绝了转换，Err 为 Guard 返回的原始错误
+type GuardRejectedError struct {
+	Task  string
+	State State
+	Event Event
+	Err   error
+}
+
+func (e *GuardRejectedError) Error() string {
+	return fmt.Sprintf("guard %s rejected %s in %s: %v", e.Task, e.Event, e.State, e.Err)
+}
+
+func (e *GuardRejectedError) Is(target error) bool {
+	return target == ErrGuardRejected
+}
+
+func (e *GuardRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// TaskFailedError 非 Guard 阶段的任务执行失败，转换已回滚
+type TaskFailedError struct {
+	Phase Phase
+	Task  string
+	Err   error
+}
+
+func (e *TaskFailedError) Error() string {
+	return fmt.Sprintf("%s task %s failed: %v", e.Phase, e.Task, e.Err)
+}
+
+func (e *TaskFailedError) Is(target error) bool {
+	return target == ErrTaskFailed
+}
+
+func (e *TaskFailedError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownWorkflowError Registry 中没有该工作流或版本
+type UnknownWorkflowError struct {
+	Name    string
+	Version string
+}
+
+func (e *UnknownWorkflowError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("unknown workflow %s", e.Name)
+	}
+	return fmt.Sprintf("unknown workflow %s version %s", e.Name, e.Version)
+}
+
+func (e *UnknownWorkflowError) Is(target error) bool {
+	return target == ErrUnknownWorkflow
+}
@@ -0,0 +1,108 @@
+package workflow
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry 按名称与版本管理状态机。工单固定在创建时的版本上运行，
+// 修改流程时注册新版本而不是修改旧版本，进行中的工单按原流程走完。
+type Registry struct {
+	mu       sync.RWMutex
+	machines map[string]map[string]*StateMachine
+	versions map[string][]string // 按注册顺序排列，最后一个为最新版本
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		machines: make(map[string]map[string]*StateMachine),
+		versions: make(map[string][]string),
+	}
+}
+
+// Register 注册工作流 name 的 version 版本，后注册的版本成为最新版本
+func (r *Registry) Register(name, version string, sm *StateMachine) error {
+	if name == "" || version == "" {
+		return fmt.Errorf("workflow registry: name and version are required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.machines[name][version]; ok {
+		return fmt.Errorf("workflow registry: %s %s already registered", name, version)
+	}
+	if r.machines[name] == nil {
+		r.machines[name] = make(map[string]*StateMachine)
+	}
+	r.machines[name][version] = sm
+	r.versions[name] = append(r.versions[name], version)
+	return nil
+}
+
+// RegisterDefinition 根据定义构建状态机并以 def.Name 与 def.Version 注册
+func (r *Registry) RegisterDefinition(def *Definition, tasks TaskRegistry) (*StateMachine, error) {
+	sm, err := NewStateMachineFromDefinition(def, tasks)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Register(def.Name, def.Version, sm); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Get 返回指定版本的状态机。version 为空表示版本化之前创建的存量工单，使用最早注册的版本
+func (r *Registry) Get(name, version string) (*StateMachine, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.versions[name]
+	if version == "" && len(versions) > 0 {
+		version = versions[0]
+	}
+	sm, ok := r.machines[name][version]
+	if !ok {
+		return nil, &UnknownWorkflowError{Name: name, Version: version}
+	}
+	return sm, nil
+}
+
+// Latest 返回工作流 name 最新注册的版本，新工单使用该版本
+func (r *Registry) Latest(name string) (string, *StateMachine, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.versions[name]
+	if len(versions) == 0 {
+		return "", nil, &UnknownWorkflowError{Name: name}
+	}
+	version := versions[len(versions)-1]
+	return version, r.machines[name][version], nil
+}
+
+// Versions 返回工作流 name 的全部版本，按注册顺序排列
+func (r *Registry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.versions[name]...)
+}
+
+// Each 遍历所有状态机，同一工作流的版本按注册顺序
+func (r *Registry) Each(fn func(name, version string, sm *StateMachine) error) error {
+	type entry struct {
+		name, version string
+		sm            *StateMachine
+	}
+	r.mu.RLock()
+	var entries []entry
+	for name, versions := range r.versions {
+		for _, version := range versions {
+			entries = append(entries, entry{name, version, r.machines[name][version]})
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, e := range entries {
+		if err := fn(e.name, e.version, e.sm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package workflow
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	v1, v2 := NewStateMachine(), NewStateMachine()
+	if err := r.Register("ticket", "v1", v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("ticket", "v2", v2); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("ticket", "v1", v2); err == nil {
+		t.Error("Register() duplicate version error = nil")
+	}
+
+	if version, sm, err := r.Latest("ticket"); err != nil || version != "v2" || sm != v2 {
+		t.Errorf("Latest() = %s, %p, %v, want v2", version, sm, err)
+	}
+	if sm, err := r.Get("ticket", "v1"); err != nil || sm != v1 {
+		t.Errorf("Get(v1) = %p, %v, want v1", sm, err)
+	}
+	if sm, err := r.Get("ticket", ""); err != nil || sm != v1 {
+		t.Errorf("Get(\"\") = %p, %v, want the earliest version", sm, err)
+	}
+	if got := r.Versions("ticket"); !reflect.DeepEqual(got, []string{"v1", "v2"}) {
+		t.Errorf("Versions() = %v, want [v1 v2]", got)
+	}
+
+	_, err := r.Get("ticket", "v3")
+	var uerr *UnknownWorkflowError
+	if !errors.As(err, &uerr) || uerr.Version != "v3" || !errors.Is(err, ErrUnknownWorkflow) {
+		t.Errorf("Get(v3) error = %v, want UnknownWorkflowError", err)
+	}
+	if _, _, err := r.Latest("incident"); !errors.Is(err, ErrUnknownWorkflow) {
+		t.Errorf("Latest(incident) error = %v, want ErrUnknownWorkflow", err)
+	}
+}
+
+func TestRegistry_RegisterDefinition(t *testing.T) {
+	def, err := ParseDefinition([]byte("name: simple\nversion: \"2\"\nstates:\n  - name: New\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	sm, err := r.RegisterDefinition(def, NewTaskRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Get("simple", "2"); err != nil || got != sm {
+		t.Errorf("Get(simple, 2) = %p, %v, want %p", got, err, sm)
+	}
+}
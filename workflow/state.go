@@ -3,6 +3,10 @@ package workflow
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/kekexiaoai/ticket/model"
@@ -16,6 +20,9 @@ const (
 	StatePending       State = "Pending"
 	StateInitialReview State = "InitialReview"
 	StateInProgress    State = "InProgress"
+	StateWorking       State = "Working"   // InProgress 的子状态
+	StateOnHold        State = "OnHold"    // InProgress 的子状态
+	StateSubmitted     State = "Submitted" // InProgress 的子状态，已提交、等待最终审批人领取
 	StateFinalApproval State = "FinalApproval"
 	StateCompleted     State = "Completed"
 	StateClosed        State = "Closed"
@@ -32,6 +39,7 @@ const (
 	EventRejectInitial  Event = "RejectInitial"
 	EventDenyInitial    Event = "DenyInitial"
 	EventSubmitFinal    Event = "SubmitFinal"
+	EventClaimFinal     Event = "ClaimFinal"
 	EventApproveFinal   Event = "ApproveFinal"
 	EventRejectFinal    Event = "RejectFinal"
 	EventArchive        Event = "Archive"
@@ -39,82 +47,134 @@ const (
 	EventReassign       Event = "Reassign"
 	EventHold           Event = "Hold"
 	EventResume         Event = "Resume"
+	EventEscalate       Event = "Escalate"
 )
 
+// SystemActor 定时器等系统行为触发转换时使用的操作人
+const SystemActor = "system"
+
 // Task 定义任务
 type Task struct {
 	Name    string
-	Execute func(ctx context.Context, ticket *model.Ticket, event Event) error
+	Execute func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error
+	// Compensate 可选，转换失败时按执行的逆序调用，用于撤销 Execute 产生的副作用
+	Compensate func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error
 }
 
 // Node 定义工作流节点
 type Node struct {
 	State       State
+	Parent      State // 所属的复合状态，顶层状态为空
+	Initial     State // 复合状态的初始子状态，进入复合状态时自动进入
 	BeforeTasks []Task
 	AfterTasks  []Task
 	OnEnter     []Task // 进入状态时
 	OnExit      []Task // 退出状态时
 	Guards      []Task // 转换条件检查
+	Timers      []Timer
+	Approval    *ApprovalSet // 会签规则，见 RegisterApprovals
+	Terminal    bool         // 终止状态，工单到达后流程结束
+}
+
+// Timer 定义状态上的定时转换：进入状态 After 之后由 SystemActor 触发 Event
+type Timer struct {
+	Name  string
+	After time.Duration
+	Event Event
+}
+
+// Edge 定义一条状态转换，Guards 与 Actions 只在该事件上执行
+type Edge struct {
+	From    State
+	Event   Event
+	To      State
+	Guards  []Task // 在源状态的节点 Guard 之后执行
+	Actions []Task // 状态更新之后、OnEnter 之前执行
+}
+
+// Authorizer 在 Guard 之前检查 actor 是否有权触发事件，state 为转换表中声明该转换的状态。
+// 拒绝时返回包装了 ErrPermissionDenied 的错误，无法判断时返回其他错误
+type Authorizer interface {
+	Authorize(ctx context.Context, ticket *model.Ticket, state State, event Event, actor string) error
 }
 
 // StateMachine 状态机
 type StateMachine struct {
-	transitions map[State]map[Event]State
+	initial     State
+	transitions map[State]map[Event]*Edge
 	nodes       map[State]*Node
+	events      map[Event]bool // 声明的事件，供 Validate 检查未使用的事件
+	authorizer  Authorizer
+	frozen      bool // 冻结后不可修改，可在 goroutine 间共享
 }
 
 func NewStateMachine() *StateMachine {
-	sm := &StateMachine{
-		transitions: make(map[State]map[Event]State),
-		nodes:       make(map[State]*Node),
-	}
+	sm := newStateMachine(StateNew)
 	sm.initTransitions()
 	sm.initNodes()
+	sm.RegisterEvents(EventSubmit, EventAssign, EventApproveInitial, EventRejectInitial, EventDenyInitial,
+		EventSubmitFinal, EventClaimFinal, EventApproveFinal, EventRejectFinal, EventArchive, EventCancel,
+		EventReassign, EventHold, EventResume, EventEscalate)
 	return sm
 }
 
-func (sm *StateMachine) initTransitions() {
-	sm.transitions[StateNew] = map[Event]State{EventSubmit: StatePending}
-	sm.transitions[StatePending] = map[Event]State{
-		EventAssign: StateInitialReview,
-		EventCancel: StateCanceled,
-	}
-	sm.transitions[StateInitialReview] = map[Event]State{
-		EventApproveInitial: StateInProgress,
-		EventRejectInitial:  StateNew,
-		EventDenyInitial:    StateCanceled,
-	}
-	sm.transitions[StateInProgress] = map[Event]State{
-		EventSubmitFinal: StateFinalApproval,
-		EventReassign:    StateInProgress,
-		EventHold:        StateInProgress,
-		EventResume:      StateInProgress,
+func newStateMachine(initial State) *StateMachine {
+	return &StateMachine{
+		initial:     initial,
+		transitions: make(map[State]map[Event]*Edge),
+		nodes:       make(map[State]*Node),
+		events:      make(map[Event]bool),
 	}
-	sm.transitions[StateFinalApproval] = map[Event]State{
-		EventApproveFinal: StateCompleted,
-		EventRejectFinal:  StateInProgress,
+}
+
+// InitialState 返回新工单的初始状态
+func (sm *StateMachine) InitialState() State {
+	return sm.initial
+}
+
+func (sm *StateMachine) initTransitions() {
+	sm.addTransition(StateNew, EventSubmit, StatePending)
+	sm.addTransition(StatePending, EventAssign, StateInitialReview)
+	sm.addTransition(StatePending, EventCancel, StateCanceled)
+	sm.addTransition(StateInitialReview, EventApproveInitial, StateInProgress)
+	sm.addTransition(StateInitialReview, EventRejectInitial, StateNew)
+	sm.addTransition(StateInitialReview, EventDenyInitial, StateCanceled)
+	sm.addTransition(StateInitialReview, EventEscalate, StateInitialReview)
+	sm.addTransition(StateWorking, EventSubmitFinal, StateSubmitted)
+	sm.addTransition(StateWorking, EventReassign, StateWorking)
+	sm.addTransition(StateWorking, EventHold, StateOnHold)
+	sm.addTransition(StateOnHold, EventResume, StateWorking)
+	sm.addTransition(StateSubmitted, EventClaimFinal, StateFinalApproval)
+	sm.addTransition(StateFinalApproval, EventApproveFinal, StateCompleted)
+	sm.addTransition(StateFinalApproval, EventRejectFinal, StateInProgress)
+	sm.addTransition(StateCompleted, EventArchive, StateClosed)
+}
+
+func (sm *StateMachine) addTransition(from State, event Event, to State) {
+	if sm.transitions[from] == nil {
+		sm.transitions[from] = make(map[Event]*Edge)
 	}
-	sm.transitions[StateCompleted] = map[Event]State{EventArchive: StateClosed}
+	sm.transitions[from][event] = &Edge{From: from, Event: event, To: to}
 }
 
 func (sm *StateMachine) initNodes() {
 	sm.nodes[StateNew] = &Node{State: StateNew}
 	sm.nodes[StatePending] = &Node{State: StatePending}
 	sm.nodes[StateInitialReview] = &Node{State: StateInitialReview}
-	sm.nodes[StateInProgress] = &Node{State: StateInProgress}
+	sm.nodes[StateInProgress] = &Node{State: StateInProgress, Initial: StateWorking}
+	sm.nodes[StateWorking] = &Node{State: StateWorking, Parent: StateInProgress}
+	sm.nodes[StateOnHold] = &Node{State: StateOnHold, Parent: StateInProgress}
+	sm.nodes[StateSubmitted] = &Node{State: StateSubmitted, Parent: StateInProgress}
 	sm.nodes[StateFinalApproval] = &Node{State: StateFinalApproval}
 	sm.nodes[StateCompleted] = &Node{State: StateCompleted}
-	sm.nodes[StateClosed] = &Node{State: StateClosed}
-	sm.nodes[StateCanceled] = &Node{State: StateCanceled}
+	sm.nodes[StateClosed] = &Node{State: StateClosed, Terminal: true}
+	sm.nodes[StateCanceled] = &Node{State: StateCanceled, Terminal: true}
 }
 
 // RegisterTasks 注册任务
 func (sm *StateMachine) RegisterTasks(state State, before, after, onEnter, onExit, guards []Task) {
-	node, ok := sm.nodes[state]
-	if !ok {
-		node = &Node{State: state}
-		sm.nodes[state] = node
-	}
+	sm.mustBeMutable()
+	node := sm.node(state)
 	node.BeforeTasks = append(node.BeforeTasks, before...)
 	node.AfterTasks = append(node.AfterTasks, after...)
 	node.OnEnter = append(node.OnEnter, onEnter...)
@@ -122,43 +182,356 @@ func (sm *StateMachine) RegisterTasks(state State, before, after, onEnter, onExi
 	node.Guards = append(node.Guards, guards...)
 }
 
-func (sm *StateMachine) Transition(ctx context.Context, ticket *model.Ticket, event Event) (State, error) {
-	currentState := State(ticket.CurrentState)
-	nextState, ok := sm.transitions[currentState][event]
+// RegisterEvents 声明状态机使用的事件，Validate 会报告没有被任何转换使用的事件
+func (sm *StateMachine) RegisterEvents(events ...Event) {
+	sm.mustBeMutable()
+	for _, event := range events {
+		sm.events[event] = true
+	}
+}
+
+// SetAuthorizer 设置权限检查，为 nil 时不做检查。不可修改的状态机使用 WithAuthorizer
+func (sm *StateMachine) SetAuthorizer(a Authorizer) {
+	sm.mustBeMutable()
+	sm.authorizer = a
+}
+
+// WithAuthorizer 返回使用 a 做权限检查的状态机副本，与原状态机共享转换表与任务，原状态机不受影响
+func (sm *StateMachine) WithAuthorizer(a Authorizer) *StateMachine {
+	c := *sm
+	c.authorizer = a
+	return &c
+}
+
+// Clone 返回可修改的副本，包括冻结的状态机。副本拥有独立的转换表与节点，
+// 在副本上注册任务、会签等不影响原状态机，任务本身与原状态机共享
+func (sm *StateMachine) Clone() *StateMachine {
+	c := newStateMachine(sm.initial)
+	c.authorizer = sm.authorizer
+	for from, edges := range sm.transitions {
+		c.transitions[from] = make(map[Event]*Edge, len(edges))
+		for event, edge := range edges {
+			e := *edge
+			// 截断容量，副本追加任务时不会写入原状态机的底层数组
+			e.Guards, e.Actions = slices.Clip(e.Guards), slices.Clip(e.Actions)
+			c.transitions[from][event] = &e
+		}
+	}
+	for state, node := range sm.nodes {
+		n := *node
+		n.BeforeTasks, n.AfterTasks = slices.Clip(n.BeforeTasks), slices.Clip(n.AfterTasks)
+		n.OnEnter, n.OnExit, n.Guards = slices.Clip(n.OnEnter), slices.Clip(n.OnExit), slices.Clip(n.Guards)
+		n.Timers = slices.Clip(n.Timers)
+		c.nodes[state] = &n
+	}
+	maps.Copy(c.events, sm.events)
+	return c
+}
+
+// Frozen 判断状态机是否不可修改
+func (sm *StateMachine) Frozen() bool {
+	return sm.frozen
+}
+
+// Freeze 冻结状态机，此后注册任务、事件、定时器等修改操作 panic 或返回 ErrFrozen，
+// 转换只读取状态机，冻结的状态机可以在 goroutine 间并发使用
+func (sm *StateMachine) Freeze() {
+	sm.frozen = true
+}
+
+// mustBeMutable 修改不可修改的状态机属于编程错误
+func (sm *StateMachine) mustBeMutable() {
+	if sm.frozen {
+		panic(ErrFrozen)
+	}
+}
+
+// authorize 调用 Authorizer，拒绝时返回 ForbiddenError，其他错误原样返回
+func (sm *StateMachine) authorize(ctx context.Context, ticket *model.Ticket, edge *Edge, actor string) error {
+	if sm.authorizer == nil {
+		return nil
+	}
+	err := sm.authorizer.Authorize(ctx, ticket, edge.From, edge.Event, actor)
+	if errors.Is(err, ErrPermissionDenied) {
+		return &ForbiddenError{Actor: actor, State: edge.From, Event: edge.Event, Err: err}
+	}
+	return err
+}
+
+// RegisterTransitionTasks 为 from 状态上的 event 转换注册 Guard 与 Action
+func (sm *StateMachine) RegisterTransitionTasks(from State, event Event, guards, actions []Task) error {
+	if sm.frozen {
+		return ErrFrozen
+	}
+	edge, ok := sm.transitions[from][event]
 	if !ok {
-		return currentState, errors.New("invalid transition")
+		return &InvalidTransitionError{From: from, Event: event}
 	}
+	edge.Guards = append(edge.Guards, guards...)
+	edge.Actions = append(edge.Actions, actions...)
+	return nil
+}
+
+// RegisterTimers 为状态注册定时器，复合状态上的定时器在其所有子状态中生效
+func (sm *StateMachine) RegisterTimers(state State, timers ...Timer) {
+	sm.mustBeMutable()
+	node := sm.node(state)
+	node.Timers = append(node.Timers, timers...)
+}
+
+// ActiveTimer 工单当前生效的定时器，State 为定时器注册所在的状态
+type ActiveTimer struct {
+	Timer
+	State State
+}
 
-	// 执行 Guard 检查
-	if node, ok := sm.nodes[currentState]; ok {
-		for _, guard := range node.Guards {
-			if err := guard.Execute(ctx, ticket, event); err != nil {
-				return currentState, err
+// ActiveTimers 返回处于 state 时生效的定时器，包括祖先状态上的定时器
+func (sm *StateMachine) ActiveTimers(state State) []ActiveTimer {
+	var timers []ActiveTimer
+	for _, s := range sm.ancestry(sm.resolve(state)) {
+		if node, ok := sm.nodes[s]; ok {
+			for _, timer := range node.Timers {
+				timers = append(timers, ActiveTimer{Timer: timer, State: s})
 			}
 		}
 	}
+	return timers
+}
 
-	// 执行 Before 任务
-	if node, ok := sm.nodes[currentState]; ok {
-		for _, task := range node.BeforeTasks {
-			if err := task.Execute(ctx, ticket, event); err != nil {
-				return currentState, err
-			}
+// EnteredAt 根据历史计算工单最近一次进入 state 的时间，工单不在该状态时返回 false。
+// 复合状态内子状态之间的转换不算重新进入；叶子状态的自循环（如 Reassign）算作重新进入，
+// 会签的部分投票等停留在原状态的记录不算。
+func (sm *StateMachine) EnteredAt(ticket *model.Ticket, state State) (time.Time, bool) {
+	if !sm.IsIn(sm.resolve(State(ticket.CurrentState)), state) {
+		return time.Time{}, false
+	}
+	for i := len(ticket.History) - 1; i >= 0; i-- {
+		h := ticket.History[i]
+		if !sm.IsIn(State(h.FromState), state) || sm.selfLoop(h, state) {
+			return h.Timestamp, true
 		}
 	}
+	return ticket.CreatedAt, true
+}
 
-	// 执行 OnExit 任务
-	if node, ok := sm.nodes[currentState]; ok {
-		for _, task := range node.OnExit {
-			if err := task.Execute(ctx, ticket, event); err != nil {
-				return currentState, err
-			}
+// selfLoop 判断历史记录是否为 state 上的自循环转换：事件在转换表中的目标就是 state。
+// 会签的部分投票与迁移同样记录 FromState 等于 ToState 的历史，但工单没有离开状态
+func (sm *StateMachine) selfLoop(h model.History, state State) bool {
+	if h.FromState != string(state) || h.ToState != string(state) {
+		return false
+	}
+	_, next, ok := sm.lookup(state, Event(h.Event))
+	return ok && next == state
+}
+
+// RegisterSubStates 将 children 注册为 parent 的子状态，进入 parent 时自动进入 initial。
+// child 是 parent 自身或其祖先、或者 initial 最终解析回 parent 时 panic，成环的层级会让状态解析无法结束
+func (sm *StateMachine) RegisterSubStates(parent, initial State, children ...State) {
+	sm.mustBeMutable()
+	for _, child := range children {
+		if sm.IsIn(parent, child) {
+			panic(fmt.Sprintf("workflow: state %s is its own ancestor", child))
+		}
+	}
+	for s := initial; s != ""; s = sm.nodes[s].Initial {
+		if s == parent {
+			panic(fmt.Sprintf("workflow: initial state of %s resolves to itself", parent))
+		}
+		if _, ok := sm.nodes[s]; !ok {
+			break
+		}
+	}
+	sm.node(parent).Initial = initial
+	for _, child := range children {
+		sm.node(child).Parent = parent
+	}
+}
+
+func (sm *StateMachine) node(state State) *Node {
+	node, ok := sm.nodes[state]
+	if !ok {
+		node = &Node{State: state}
+		sm.nodes[state] = node
+	}
+	return node
+}
+
+// States 返回状态机中的全部状态，按名称排序
+func (sm *StateMachine) States() []State {
+	states := make([]State, 0, len(sm.nodes))
+	for state := range sm.nodes {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	return states
+}
+
+// HasState 判断状态机中是否定义了 state
+func (sm *StateMachine) HasState(state State) bool {
+	_, ok := sm.nodes[state]
+	return ok
+}
+
+// Resolve 返回工单实际所处的叶子状态：复合状态解析为其初始子状态
+func (sm *StateMachine) Resolve(state State) State {
+	return sm.resolve(state)
+}
+
+// IsIn 判断 current 是否为 state 本身或其子状态
+func (sm *StateMachine) IsIn(current, state State) bool {
+	for _, s := range sm.ancestry(current) {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// LeafStates 返回 state 下的全部叶子状态，按名称排序；state 本身是叶子状态时只返回它自己。
+// 工单只会处于叶子状态，按复合状态查询工单时用它展开
+func (sm *StateMachine) LeafStates(state State) []State {
+	var leaves []State
+	for _, s := range sm.States() {
+		if sm.resolve(s) == s && sm.IsIn(s, state) {
+			leaves = append(leaves, s)
+		}
+	}
+	return leaves
+}
+
+// IsTerminal 判断工单处于 state 时流程是否已经结束：state 标记为终止状态，或它及其祖先上都没有转换
+func (sm *StateMachine) IsTerminal(state State) bool {
+	if node, ok := sm.nodes[state]; ok && node.Terminal {
+		return true
+	}
+	return !sm.hasOutgoing(state)
+}
+
+// resolve 将复合状态解析为最终进入的叶子状态
+func (sm *StateMachine) resolve(state State) State {
+	for {
+		node, ok := sm.nodes[state]
+		if !ok || node.Initial == "" {
+			return state
+		}
+		state = node.Initial
+	}
+}
+
+// ancestry 返回 state 及其所有祖先，由内向外
+func (sm *StateMachine) ancestry(state State) []State {
+	chain := []State{state}
+	for {
+		node, ok := sm.nodes[state]
+		if !ok || node.Parent == "" {
+			return chain
 		}
+		state = node.Parent
+		chain = append(chain, state)
 	}
+}
 
-	// 更新状态和 ReassignCount
+// lookup 从当前状态开始逐级向外查找事件对应的转换，返回转换边及解析后的目标叶子状态
+func (sm *StateMachine) lookup(current State, event Event) (*Edge, State, bool) {
+	for _, s := range sm.ancestry(current) {
+		if edge, ok := sm.transitions[s][event]; ok {
+			return edge, sm.resolve(edge.To), true
+		}
+	}
+	return nil, "", false
+}
+
+// path 计算从 from 到 to 需要退出（由内向外）和进入（由外向内）的状态
+func (sm *StateMachine) path(from, to State) (exits, enters []State) {
+	if from == to {
+		return []State{from}, []State{to}
+	}
+	fromChain, toChain := sm.ancestry(from), sm.ancestry(to)
+	common := make(map[State]bool, len(toChain))
+	for _, s := range toChain {
+		common[s] = true
+	}
+	var lca State
+	for _, s := range fromChain {
+		if common[s] {
+			lca = s
+			break
+		}
+		exits = append(exits, s)
+	}
+	for _, s := range toChain {
+		if s == lca {
+			break
+		}
+		enters = append([]State{s}, enters...)
+	}
+	return exits, enters
+}
+
+// Transition 触发事件。设置了 Authorizer 时先检查权限，再执行 Guard。复合状态中的事件由内向外查找；节点的 Guard、Before 与 After 任务
+// 会在叶子状态及其祖先上执行（由内向外），OnExit/OnEnter 只在实际退出/进入的状态上执行，
+// 转换边上的 Guard 与 Action 只在该事件上执行。
+// 转换是原子的：任一阶段失败时，已执行任务的 Compensate 按逆序调用，工单恢复到转换前的状态。
+// actor 为触发转换的操作人，记录在 History 中，任务可通过 ActorFromContext 读取；
+// payload 传入每个任务并记录在 History 中，其中 Assignee 非空时更新工单处理人。
+func (sm *StateMachine) Transition(ctx context.Context, ticket *model.Ticket, event Event, actor string, payload model.Payload) (State, error) {
+	currentState := sm.resolve(State(ticket.CurrentState))
+	edge, nextState, ok := sm.lookup(currentState, event)
+	if !ok {
+		return State(ticket.CurrentState), &InvalidTransitionError{From: currentState, Event: event}
+	}
+	ctx = WithActor(ctx, actor)
+	if err := sm.authorize(ctx, ticket, edge, actor); err != nil {
+		return State(ticket.CurrentState), err
+	}
+	approval := sm.approvalFor(edge)
+	if approval != nil {
+		if err := sm.checkVote(ticket, edge, approval, actor); err != nil {
+			return State(ticket.CurrentState), err
+		}
+	}
+	exits, enters := sm.path(currentState, nextState)
+	tx := newTransaction(ticket, currentState, event, payload)
+
+	// 执行 Guard 检查：先节点 Guard，再转换边上的 Guard
+	if err := tx.run(ctx, PhaseGuard, sm.tasks(sm.ancestry(currentState), func(n *Node) []Task { return n.Guards })); err != nil {
+		return State(ticket.CurrentState), tx.rollback(ctx, err)
+	}
+	if err := tx.run(ctx, PhaseGuard, edge.Guards); err != nil {
+		return State(ticket.CurrentState), tx.rollback(ctx, err)
+	}
+
+	// 会签：记录投票，通过票数不足时停留在当前状态，不执行任何任务
+	if approval != nil && !sm.vote(ticket, edge, approval, actor, payload) {
+		ticket.UpdatedAt = time.Now()
+		ticket.History = append(ticket.History, model.History{
+			FromState:   ticket.CurrentState,
+			ToState:     ticket.CurrentState,
+			Event:       string(event),
+			Timestamp:   time.Now(),
+			TriggeredBy: actor,
+			Payload:     payload,
+		})
+		return State(ticket.CurrentState), nil
+	}
+
+	// 执行 Before 任务
+	if err := tx.run(ctx, PhaseBefore, sm.tasks(sm.ancestry(currentState), func(n *Node) []Task { return n.BeforeTasks })); err != nil {
+		return State(ticket.CurrentState), tx.rollback(ctx, err)
+	}
+
+	// 执行 OnExit 任务
+	if err := tx.run(ctx, PhaseOnExit, sm.tasks(exits, func(n *Node) []Task { return n.OnExit })); err != nil {
+		return State(ticket.CurrentState), tx.rollback(ctx, err)
+	}
+
+	// 更新状态、处理人和 ReassignCount
 	oldState := ticket.CurrentState
 	ticket.CurrentState = string(nextState)
+	sm.clearApprovals(ticket, enters)
+	if payload.Assignee != "" {
+		ticket.AssigneeID = payload.Assignee
+	}
 	if event == EventReassign {
 		ticket.ReassignCount++
 	}
@@ -168,26 +541,35 @@ func (sm *StateMachine) Transition(ctx context.Context, ticket *model.Ticket, ev
 		ToState:     string(nextState),
 		Event:       string(event),
 		Timestamp:   time.Now(),
-		TriggeredBy: ticket.AssigneeID,
+		TriggeredBy: actor,
+		Payload:     payload,
 	})
 
+	// 执行转换边上的 Action
+	if err := tx.run(ctx, PhaseAction, edge.Actions); err != nil {
+		return State(oldState), tx.rollback(ctx, err)
+	}
+
 	// 执行 OnEnter 任务
-	if node, ok := sm.nodes[nextState]; ok {
-		for _, task := range node.OnEnter {
-			if err := task.Execute(ctx, ticket, event); err != nil {
-				return nextState, err
-			}
-		}
+	if err := tx.run(ctx, PhaseOnEnter, sm.tasks(enters, func(n *Node) []Task { return n.OnEnter })); err != nil {
+		return State(oldState), tx.rollback(ctx, err)
 	}
 
 	// 执行 After 任务
-	if node, ok := sm.nodes[nextState]; ok {
-		for _, task := range node.AfterTasks {
-			if err := task.Execute(ctx, ticket, event); err != nil {
-				return nextState, err
-			}
-		}
+	if err := tx.run(ctx, PhaseAfter, sm.tasks(sm.ancestry(nextState), func(n *Node) []Task { return n.AfterTasks })); err != nil {
+		return State(oldState), tx.rollback(ctx, err)
 	}
 
 	return nextState, nil
 }
+
+// tasks 按 states 的顺序收集各节点在某一阶段的任务
+func (sm *StateMachine) tasks(states []State, tasksOf func(*Node) []Task) []Task {
+	var tasks []Task
+	for _, s := range states {
+		if node, ok := sm.nodes[s]; ok {
+			tasks = append(tasks, tasksOf(node)...)
+		}
+	}
+	return tasks
+}
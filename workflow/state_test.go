@@ -3,6 +3,8 @@ package workflow
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -20,13 +22,19 @@ func TestStateMachine_Transition(t *testing.T) {
 		{"New to Pending", StateNew, EventSubmit, StatePending, false},
 		{"Pending to InitialReview", StatePending, EventAssign, StateInitialReview, false},
 		{"Pending to Canceled", StatePending, EventCancel, StateCanceled, false},
-		{"InitialReview to InProgress", StateInitialReview, EventApproveInitial, StateInProgress, false},
+		{"InitialReview to InProgress (Working)", StateInitialReview, EventApproveInitial, StateWorking, false},
 		{"InitialReview to New", StateInitialReview, EventRejectInitial, StateNew, false},
 		{"InitialReview to Canceled", StateInitialReview, EventDenyInitial, StateCanceled, false},
-		{"InProgress to FinalApproval", StateInProgress, EventSubmitFinal, StateFinalApproval, false},
-		{"InProgress self-loop (Reassign)", StateInProgress, EventReassign, StateInProgress, false},
+		{"Working to Submitted", StateWorking, EventSubmitFinal, StateSubmitted, false},
+		{"Submitted to FinalApproval", StateSubmitted, EventClaimFinal, StateFinalApproval, false},
+		{"Working cannot ClaimFinal", StateWorking, EventClaimFinal, StateWorking, true},
+		{"Working self-loop (Reassign)", StateWorking, EventReassign, StateWorking, false},
+		{"Working to OnHold", StateWorking, EventHold, StateOnHold, false},
+		{"OnHold to Working", StateOnHold, EventResume, StateWorking, false},
+		{"OnHold cannot SubmitFinal", StateOnHold, EventSubmitFinal, StateOnHold, true},
+		{"Legacy InProgress resolves to Working", StateInProgress, EventHold, StateOnHold, false},
 		{"FinalApproval to Completed", StateFinalApproval, EventApproveFinal, StateCompleted, false},
-		{"FinalApproval to InProgress", StateFinalApproval, EventRejectFinal, StateInProgress, false},
+		{"FinalApproval to InProgress (Working)", StateFinalApproval, EventRejectFinal, StateWorking, false},
 		{"Completed to Closed", StateCompleted, EventArchive, StateClosed, false},
 		{"Invalid transition", StateNew, EventCancel, StateNew, true},
 	}
@@ -40,7 +48,7 @@ func TestStateMachine_Transition(t *testing.T) {
 				CreatedAt:    time.Now(),
 			}
 
-			gotState, err := sm.Transition(context.Background(), ticket, tt.event)
+			gotState, err := sm.Transition(context.Background(), ticket, tt.event, "user123", model.Payload{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Transition() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -67,28 +75,28 @@ func TestStateMachine_Hooks(t *testing.T) {
 	// 注册钩子
 	var guardCalled, beforeCalled, onExitCalled, onEnterCalled, afterCalled bool
 	sm.RegisterTasks(StatePending,
-		[]Task{{Name: "Before", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "Before", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			beforeCalled = true
 			return nil
 		}}},
 		nil,
 		nil,
-		[]Task{{Name: "OnExit", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "OnExit", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			onExitCalled = true
 			return nil
 		}}},
-		[]Task{{Name: "Guard", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "Guard", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			guardCalled = true
 			return nil
 		}}},
 	)
 	sm.RegisterTasks(StateInitialReview,
 		nil,
-		[]Task{{Name: "After", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "After", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			afterCalled = true
 			return nil
 		}}},
-		[]Task{{Name: "OnEnter", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "OnEnter", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			onEnterCalled = true
 			return nil
 		}}},
@@ -97,7 +105,7 @@ func TestStateMachine_Hooks(t *testing.T) {
 	)
 
 	// 执行转换
-	_, err := sm.Transition(context.Background(), ticket, EventAssign)
+	_, err := sm.Transition(context.Background(), ticket, EventAssign, "user123", model.Payload{})
 	if err != nil {
 		t.Fatalf("Transition() error = %v", err)
 	}
@@ -138,7 +146,7 @@ func TestStateMachine_GuardFailure(t *testing.T) {
 		nil,
 		nil,
 		nil,
-		[]Task{{Name: "GuardFinalApproval", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "GuardFinalApproval", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			if event == EventApproveFinal && ticket.AssigneeID != "admin" {
 				return errors.New("只有管理员可以最终审批")
 			}
@@ -146,7 +154,7 @@ func TestStateMachine_GuardFailure(t *testing.T) {
 		}}},
 	)
 
-	_, err := sm.Transition(context.Background(), ticket, EventApproveFinal)
+	_, err := sm.Transition(context.Background(), ticket, EventApproveFinal, "user123", model.Payload{})
 	if err == nil {
 		t.Error("Expected error from Guard, got nil")
 	}
@@ -168,18 +176,405 @@ func TestStateMachine_OnEnterFailure(t *testing.T) {
 	sm.RegisterTasks(StateInitialReview,
 		nil,
 		nil,
-		[]Task{{Name: "OnEnterFail", Execute: func(ctx context.Context, ticket *model.Ticket, event Event) error {
+		[]Task{{Name: "OnEnterFail", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
 			return errors.New("OnEnter failed")
 		}}},
 		nil,
 		nil,
 	)
 
-	_, err := sm.Transition(context.Background(), ticket, EventAssign)
+	gotState, err := sm.Transition(context.Background(), ticket, EventAssign, "user123", model.Payload{})
 	if err == nil {
 		t.Error("Expected error from OnEnter, got nil")
 	}
-	if ticket.CurrentState != string(StateInitialReview) {
-		t.Errorf("Ticket.CurrentState = %v, want %v", ticket.CurrentState, StateInitialReview)
+	if gotState != StatePending {
+		t.Errorf("Transition() gotState = %v, want %v", gotState, StatePending)
+	}
+	// 转换失败后工单应恢复原状
+	if ticket.CurrentState != string(StatePending) {
+		t.Errorf("Ticket.CurrentState = %v, want %v", ticket.CurrentState, StatePending)
+	}
+	if len(ticket.History) != 0 {
+		t.Errorf("len(Ticket.History) = %d, want 0", len(ticket.History))
+	}
+}
+
+func TestStateMachine_AfterFailureRollback(t *testing.T) {
+	sm := NewStateMachine()
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		CurrentState: string(StateWorking),
+		Priority:     1,
+		CreatedAt:    time.Now(),
+		History:      []model.History{{FromState: "InitialReview", ToState: "Working", Event: "ApproveInitial"}},
+	}
+	before := ticket.Clone()
+
+	var compensated []string
+	task := func(name string, fail bool) Task {
+		return Task{
+			Name: name,
+			Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+				if fail {
+					return errors.New(name + " failed")
+				}
+				ticket.Priority++
+				return nil
+			},
+			Compensate: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+				compensated = append(compensated, name)
+				return nil
+			},
+		}
+	}
+	sm.RegisterTasks(StateWorking, []Task{task("Before", false)}, []Task{task("After1", false), task("After2", true)}, []Task{task("OnEnter", false)}, nil, nil)
+
+	if _, err := sm.Transition(context.Background(), ticket, EventReassign, "user123", model.Payload{}); err == nil {
+		t.Fatal("Expected error from After task, got nil")
+	}
+
+	wantCompensated := []string{"After1", "OnEnter", "Before"}
+	if len(compensated) != len(wantCompensated) {
+		t.Fatalf("compensated = %v, want %v", compensated, wantCompensated)
+	}
+	for i := range wantCompensated {
+		if compensated[i] != wantCompensated[i] {
+			t.Errorf("compensated[%d] = %v, want %v", i, compensated[i], wantCompensated[i])
+		}
+	}
+	if ticket.ReassignCount != before.ReassignCount || ticket.Priority != before.Priority ||
+		ticket.CurrentState != before.CurrentState || len(ticket.History) != len(before.History) ||
+		!ticket.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("ticket = %+v, want restored to %+v", ticket, before)
+	}
+}
+
+func TestStateMachine_SubStates(t *testing.T) {
+	sm := NewStateMachine()
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		CurrentState: string(StateInitialReview),
+		CreatedAt:    time.Now(),
+	}
+
+	var calls []string
+	record := func(name string) []Task {
+		return []Task{{Name: name, Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			calls = append(calls, name+":"+string(event))
+			return nil
+		}}}
+	}
+	sm.RegisterTasks(StateInProgress, nil, nil, record("EnterInProgress"), record("ExitInProgress"), nil)
+	sm.RegisterTasks(StateWorking, nil, nil, record("EnterWorking"), record("ExitWorking"), nil)
+	sm.RegisterTasks(StateOnHold, nil, nil, record("EnterOnHold"), record("ExitOnHold"), nil)
+
+	sm.RegisterTasks(StateSubmitted, nil, nil, record("EnterSubmitted"), record("ExitSubmitted"), nil)
+
+	for _, event := range []Event{EventApproveInitial, EventHold, EventResume, EventSubmitFinal, EventClaimFinal} {
+		if _, err := sm.Transition(context.Background(), ticket, event, "user123", model.Payload{}); err != nil {
+			t.Fatalf("Transition(%s) error = %v", event, err)
+		}
+	}
+
+	want := []string{
+		"EnterInProgress:ApproveInitial", "EnterWorking:ApproveInitial",
+		"ExitWorking:Hold", "EnterOnHold:Hold",
+		"ExitOnHold:Resume", "EnterWorking:Resume",
+		"ExitWorking:SubmitFinal", "EnterSubmitted:SubmitFinal",
+		"ExitSubmitted:ClaimFinal", "ExitInProgress:ClaimFinal",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls[%d] = %v, want %v", i, calls[i], want[i])
+		}
+	}
+	if !sm.IsIn(StateOnHold, StateInProgress) || !sm.IsIn(StateSubmitted, StateInProgress) || sm.IsIn(StateFinalApproval, StateInProgress) {
+		t.Error("IsIn() does not reflect the InProgress hierarchy")
+	}
+}
+
+func TestStateMachine_RegisterSubStatesCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(sm *StateMachine)
+	}{
+		{"ancestor as child", func(sm *StateMachine) { sm.RegisterSubStates(StateWorking, "", StateInProgress) }},
+		{"own child", func(sm *StateMachine) { sm.RegisterSubStates("Loop", "", "Loop") }},
+		{"initial cycle", func(sm *StateMachine) {
+			sm.RegisterSubStates("A", "B")
+			sm.RegisterSubStates("B", "A")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("RegisterSubStates() did not panic")
+				}
+			}()
+			tt.register(NewStateMachine())
+		})
+	}
+}
+
+func TestStateMachine_TransitionTasks(t *testing.T) {
+	sm := NewStateMachine()
+
+	var calls []string
+	record := func(name string) []Task {
+		return []Task{{Name: name, Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			calls = append(calls, name)
+			return nil
+		}}}
+	}
+	sm.RegisterTasks(StateFinalApproval, nil, nil, nil, record("OnExit"), record("NodeGuard"))
+	sm.RegisterTasks(StateCompleted, nil, nil, record("OnEnter"), nil, nil)
+	if err := sm.RegisterTransitionTasks(StateFinalApproval, EventApproveFinal, record("ApproveGuard"), record("ApproveAction")); err != nil {
+		t.Fatalf("RegisterTransitionTasks() error = %v", err)
+	}
+	if err := sm.RegisterTransitionTasks(StateNew, EventApproveFinal, nil, nil); err == nil {
+		t.Error("Expected error registering tasks on a missing transition, got nil")
+	}
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateFinalApproval), CreatedAt: time.Now()}
+	if _, err := sm.Transition(context.Background(), ticket, EventRejectFinal, "user123", model.Payload{}); err != nil {
+		t.Fatalf("Transition(RejectFinal) error = %v", err)
+	}
+	if want := []string{"NodeGuard", "OnExit"}; len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("RejectFinal calls = %v, want %v", calls, want)
+	}
+
+	calls = nil
+	ticket.CurrentState = string(StateFinalApproval)
+	if _, err := sm.Transition(context.Background(), ticket, EventApproveFinal, "user123", model.Payload{}); err != nil {
+		t.Fatalf("Transition(ApproveFinal) error = %v", err)
+	}
+	want := []string{"NodeGuard", "ApproveGuard", "OnExit", "ApproveAction", "OnEnter"}
+	if len(calls) != len(want) {
+		t.Fatalf("ApproveFinal calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls[%d] = %v, want %v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestStateMachine_Errors(t *testing.T) {
+	errGuard := errors.New("guard says no")
+	errAfter := errors.New("after failed")
+	sm := NewStateMachine()
+	sm.RegisterTasks(StateFinalApproval, nil, nil, nil, nil,
+		[]Task{{Name: "Deny", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			return errGuard
+		}}},
+	)
+	sm.RegisterTasks(StateClosed, nil,
+		[]Task{{Name: "FailAfter", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			return errAfter
+		}}},
+		nil, nil, nil,
+	)
+
+	t.Run("invalid transition", func(t *testing.T) {
+		ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateNew)}
+		_, err := sm.Transition(context.Background(), ticket, EventArchive, "user123", model.Payload{})
+		var target *InvalidTransitionError
+		if !errors.Is(err, ErrInvalidTransition) || !errors.As(err, &target) {
+			t.Fatalf("Transition() error = %v, want InvalidTransitionError", err)
+		}
+		if target.From != StateNew || target.Event != EventArchive {
+			t.Errorf("InvalidTransitionError = %+v", target)
+		}
+	})
+
+	t.Run("guard rejected", func(t *testing.T) {
+		ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateFinalApproval)}
+		_, err := sm.Transition(context.Background(), ticket, EventApproveFinal, "user123", model.Payload{})
+		var target *GuardRejectedError
+		if !errors.Is(err, ErrGuardRejected) || !errors.Is(err, errGuard) || !errors.As(err, &target) {
+			t.Fatalf("Transition() error = %v, want GuardRejectedError", err)
+		}
+		if target.Task != "Deny" || target.State != StateFinalApproval || target.Event != EventApproveFinal {
+			t.Errorf("GuardRejectedError = %+v", target)
+		}
+	})
+
+	t.Run("task failed", func(t *testing.T) {
+		ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateCompleted)}
+		_, err := sm.Transition(context.Background(), ticket, EventArchive, "user123", model.Payload{})
+		var target *TaskFailedError
+		if !errors.Is(err, ErrTaskFailed) || !errors.Is(err, errAfter) || !errors.As(err, &target) {
+			t.Fatalf("Transition() error = %v, want TaskFailedError", err)
+		}
+		if target.Phase != PhaseAfter || target.Task != "FailAfter" {
+			t.Errorf("TaskFailedError = %+v", target)
+		}
+		if errors.Is(err, ErrGuardRejected) {
+			t.Error("TaskFailedError must not match ErrGuardRejected")
+		}
+	})
+}
+
+func TestStateMachine_Payload(t *testing.T) {
+	sm := NewStateMachine()
+	var got model.Payload
+	sm.RegisterTasks(StateWorking, nil,
+		[]Task{{Name: "Capture", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			got = payload
+			return nil
+		}}},
+		nil, nil, nil,
+	)
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateWorking), AssigneeID: "user456"}
+	payload := model.Payload{Assignee: "user789", Comment: "交接给网络组"}
+	if _, err := sm.Transition(context.Background(), ticket, EventReassign, "user456", payload); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	if got != payload {
+		t.Errorf("task payload = %+v, want %+v", got, payload)
+	}
+	if ticket.AssigneeID != "user789" {
+		t.Errorf("Ticket.AssigneeID = %v, want user789", ticket.AssigneeID)
+	}
+	last := ticket.History[len(ticket.History)-1]
+	if last.Payload != payload || last.TriggeredBy != "user456" {
+		t.Errorf("History = %+v, want payload %+v triggered by user456", last, payload)
+	}
+}
+
+type denyAll struct{}
+
+func (denyAll) Authorize(ctx context.Context, ticket *model.Ticket, state State, event Event, actor string) error {
+	return fmt.Errorf("%w: no role", ErrPermissionDenied)
+}
+
+// brokenAuthorizer 模拟策略存储不可用
+type brokenAuthorizer struct{}
+
+var errPolicyUnavailable = errors.New("policy store unavailable")
+
+func (brokenAuthorizer) Authorize(ctx context.Context, ticket *model.Ticket, state State, event Event, actor string) error {
+	return errPolicyUnavailable
+}
+
+func TestStateMachine_AuthorizerFailureIsNotForbidden(t *testing.T) {
+	sm := NewStateMachine()
+	sm.SetAuthorizer(brokenAuthorizer{})
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateNew)}
+	_, err := sm.Transition(context.Background(), ticket, EventSubmit, "user123", model.Payload{})
+	if !errors.Is(err, errPolicyUnavailable) || errors.Is(err, ErrForbidden) {
+		t.Errorf("Transition() error = %v, want the authorizer error without ErrForbidden", err)
+	}
+	if ticket.CurrentState != string(StateNew) {
+		t.Errorf("Ticket.CurrentState = %v, want unchanged", ticket.CurrentState)
+	}
+}
+
+func TestStateMachine_AuthorizerRunsBeforeGuards(t *testing.T) {
+	sm := NewStateMachine()
+	sm.SetAuthorizer(denyAll{})
+	var guardCalled bool
+	sm.RegisterTasks(StateNew, nil, nil, nil, nil,
+		[]Task{{Name: "Guard", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error {
+			guardCalled = true
+			return nil
+		}}},
+	)
+
+	ticket := &model.Ticket{ID: "test-ticket", CurrentState: string(StateNew)}
+	_, err := sm.Transition(context.Background(), ticket, EventSubmit, "user123", model.Payload{})
+	var target *ForbiddenError
+	if !errors.Is(err, ErrForbidden) || !errors.As(err, &target) {
+		t.Fatalf("Transition() error = %v, want ForbiddenError", err)
+	}
+	if target.Actor != "user123" || target.State != StateNew || target.Event != EventSubmit {
+		t.Errorf("ForbiddenError = %+v", target)
+	}
+	if guardCalled {
+		t.Error("Guard ran although the authorizer denied the transition")
+	}
+	if got := sm.AvailableEvents(context.Background(), ticket, "user123"); len(got) != 0 {
+		t.Errorf("AvailableEvents() = %v, want none", got)
+	}
+}
+
+func TestStateMachine_EnteredAtAndTimers(t *testing.T) {
+	sm := NewStateMachine()
+	sm.RegisterTimers(StateInProgress, Timer{Name: "SLA", After: 48 * time.Hour, Event: EventHold})
+	sm.RegisterTimers(StateOnHold, Timer{Name: "Wake", After: time.Hour, Event: EventResume})
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	ticket := &model.Ticket{
+		ID:           "test-ticket",
+		CurrentState: string(StateOnHold),
+		History: []model.History{
+			{FromState: "InitialReview", ToState: "Working", Event: "ApproveInitial", Timestamp: start},
+			{FromState: "Working", ToState: "OnHold", Event: "Hold", Timestamp: start.Add(time.Hour)},
+		},
+	}
+
+	timers := sm.ActiveTimers(StateOnHold)
+	if len(timers) != 2 || timers[0].State != StateOnHold || timers[1].State != StateInProgress {
+		t.Fatalf("ActiveTimers(OnHold) = %+v, want OnHold then InProgress timers", timers)
+	}
+	if at, ok := sm.EnteredAt(ticket, StateInProgress); !ok || !at.Equal(start) {
+		t.Errorf("EnteredAt(InProgress) = %v, %v, want %v", at, ok, start)
+	}
+	if at, ok := sm.EnteredAt(ticket, StateOnHold); !ok || !at.Equal(start.Add(time.Hour)) {
+		t.Errorf("EnteredAt(OnHold) = %v, %v, want %v", at, ok, start.Add(time.Hour))
+	}
+	if _, ok := sm.EnteredAt(ticket, StatePending); ok {
+		t.Error("EnteredAt(Pending) ok = true for a state the ticket is not in")
+	}
+}
+
+func TestStateMachine_Clone(t *testing.T) {
+	sm := NewStateMachine()
+	sm.Freeze()
+	c := sm.Clone()
+	if c.Frozen() {
+		t.Fatal("Clone() of a frozen machine is frozen")
+	}
+	noop := Task{Name: "Noop", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error { return nil }}
+	if err := c.RegisterTransitionTasks(StateNew, EventSubmit, []Task{noop}, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.RegisterTasks(StatePending, []Task{noop}, nil, nil, nil, nil)
+	if err := c.RegisterApprovals(StateFinalApproval, ApprovalSet{Approve: EventApproveFinal}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 原状态机不受副本修改的影响
+	if edge := sm.transitions[StateNew][EventSubmit]; len(edge.Guards) != 0 {
+		t.Errorf("original Submit guards = %d, want 0", len(edge.Guards))
+	}
+	if node := sm.nodes[StatePending]; len(node.BeforeTasks) != 0 {
+		t.Errorf("original Pending before tasks = %d, want 0", len(node.BeforeTasks))
+	}
+	if sm.nodes[StateFinalApproval].Approval != nil {
+		t.Error("original FinalApproval has approvals registered on the clone")
+	}
+}
+
+func TestStateMachine_LeafStates(t *testing.T) {
+	sm := NewStateMachine()
+	tests := []struct {
+		state State
+		want  []State
+	}{
+		{StateInProgress, []State{StateOnHold, StateSubmitted, StateWorking}},
+		{StateWorking, []State{StateWorking}},
+		{StatePending, []State{StatePending}},
+		{"Unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := sm.LeafStates(tt.state); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LeafStates(%s) = %v, want %v", tt.state, got, tt.want)
+		}
 	}
 }
@@ -0,0 +1,61 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+// transaction 记录一次转换中已执行的任务，失败时用于补偿和回滚
+type transaction struct {
+	ticket   *model.Ticket
+	snapshot *model.Ticket
+	from     State
+	event    Event
+	payload  model.Payload
+	done     []Task
+}
+
+func newTransaction(ticket *model.Ticket, from State, event Event, payload model.Payload) *transaction {
+	return &transaction{ticket: ticket, snapshot: ticket.Clone(), from: from, event: event, payload: payload}
+}
+
+// run 依次执行某一阶段的任务，遇到第一个错误即停止并返回带类型的错误
+func (tx *transaction) run(ctx context.Context, phase Phase, tasks []Task) error {
+	for _, task := range tasks {
+		if err := task.Execute(ctx, tx.ticket, tx.event, tx.payload); err != nil {
+			return taskError(phase, task, tx.from, tx.event, err)
+		}
+		tx.done = append(tx.done, task)
+	}
+	return nil
+}
+
+// rollback 按逆序调用已执行任务的 Compensate，再将工单恢复为转换前的快照。
+// 补偿失败不会中断回滚，其错误与原始错误一并返回。
+func (tx *transaction) rollback(ctx context.Context, cause error) error {
+	errs := []error{cause}
+	for i := len(tx.done) - 1; i >= 0; i-- {
+		task := tx.done[i]
+		if task.Compensate == nil {
+			continue
+		}
+		if err := task.Compensate(ctx, tx.ticket, tx.event, tx.payload); err != nil {
+			errs = append(errs, fmt.Errorf("compensate %s: %w", task.Name, err))
+		}
+	}
+	*tx.ticket = *tx.snapshot
+	if len(errs) == 1 {
+		return cause
+	}
+	return errors.Join(errs...)
+}
+
+func taskError(phase Phase, task Task, from State, event Event, err error) error {
+	if phase == PhaseGuard {
+		return &GuardRejectedError{Task: task.Name, State: from, Event: event, Err: err}
+	}
+	return &TaskFailedError{Phase: phase, Task: task.Name, Err: err}
+}
@@ -0,0 +1,167 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IssueKind 静态检查发现的问题类别
+type IssueKind string
+
+const (
+	IssueUnknownState   IssueKind = "unknown-state"    // 注册了任务或定时器的状态不在转换表中，通常是拼写错误
+	IssueUnreachable    IssueKind = "unreachable"      // 从初始状态无法到达
+	IssueDeadEnd        IssueKind = "dead-end"         // 没有任何出边且未标记为终止状态
+	IssueUnusedEvent    IssueKind = "unused-event"     // 声明了但没有任何转换使用的事件
+	IssueTerminalOnExit IssueKind = "terminal-on-exit" // 终止状态上的 OnExit 任务永远不会执行
+	IssueTimerEvent     IssueKind = "timer-event"      // 定时器触发的事件在其状态上没有转换
+)
+
+// Issue 一个静态检查问题
+type Issue struct {
+	Kind  IssueKind
+	State State
+	Event Event
+	Msg   string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Kind, i.Msg)
+}
+
+// ValidationError Validate 发现的全部问题
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return fmt.Sprintf("invalid workflow: %s", strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidWorkflow
+}
+
+// Validate 对状态机做静态检查，存在问题时返回 *ValidationError：
+// 转换表之外的状态（如 RegisterTasks 时拼错的状态名）、从初始状态不可达的状态、
+// 未标记为终止的死胡同状态、未被使用的事件、带 OnExit 任务的终止状态，以及无法触发的定时器。
+func (sm *StateMachine) Validate() error {
+	var issues []Issue
+	add := func(kind IssueKind, state State, event Event, format string, args ...any) {
+		issues = append(issues, Issue{Kind: kind, State: state, Event: event, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	known := sm.knownStates()
+	reachable := sm.reachableStates()
+	for _, state := range sm.States() {
+		node := sm.nodes[state]
+		if !known[state] {
+			add(IssueUnknownState, state, "", "state %s is not in the transition table", state)
+			continue
+		}
+		if !reachable[state] {
+			add(IssueUnreachable, state, "", "state %s is not reachable from %s", state, sm.initial)
+		}
+		isLeaf := sm.resolve(state) == state
+		outgoing := sm.hasOutgoing(state)
+		if isLeaf && !outgoing && !node.Terminal {
+			add(IssueDeadEnd, state, "", "state %s has no outgoing transitions and is not terminal", state)
+		}
+		if (node.Terminal || isLeaf && !outgoing) && len(node.OnExit) > 0 {
+			add(IssueTerminalOnExit, state, "", "terminal state %s has OnExit tasks that never run: %s", state, taskNames(node.OnExit))
+		}
+		for _, timer := range node.Timers {
+			if _, _, ok := sm.lookup(sm.resolve(state), timer.Event); !ok {
+				add(IssueTimerEvent, state, timer.Event, "timer %s in %s fires %s, which %s does not accept", timer.Name, state, timer.Event, state)
+			}
+		}
+	}
+
+	used := make(map[Event]bool)
+	for _, edges := range sm.transitions {
+		for event := range edges {
+			used[event] = true
+		}
+	}
+	events := make([]Event, 0, len(sm.events))
+	for event := range sm.events {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+	for _, event := range events {
+		if !used[event] {
+			add(IssueUnusedEvent, "", event, "event %s is not used by any transition", event)
+		}
+	}
+
+	if len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+// knownStates 返回转换表涉及的状态：初始状态、转换的起点与终点，以及它们的祖先和初始子状态
+func (sm *StateMachine) knownStates() map[State]bool {
+	known := make(map[State]bool)
+	mark := func(state State) {
+		for _, s := range sm.ancestry(state) {
+			known[s] = true
+		}
+		for s := state; ; {
+			known[s] = true
+			node, ok := sm.nodes[s]
+			if !ok || node.Initial == "" {
+				break
+			}
+			s = node.Initial
+		}
+	}
+	mark(sm.initial)
+	for from, edges := range sm.transitions {
+		mark(from)
+		for _, edge := range edges {
+			mark(edge.To)
+		}
+	}
+	return known
+}
+
+// reachableStates 从初始状态出发沿转换遍历，到达子状态时其祖先也视为到达，
+// 处于子状态时外层状态上的转换同样可用
+func (sm *StateMachine) reachableStates() map[State]bool {
+	reachable := make(map[State]bool)
+	queue := []State{sm.resolve(sm.initial)}
+	for len(queue) > 0 {
+		leaf := queue[0]
+		queue = queue[1:]
+		if reachable[leaf] {
+			continue
+		}
+		for _, s := range sm.ancestry(leaf) {
+			reachable[s] = true
+		}
+		for _, s := range sm.ancestry(leaf) {
+			for _, edge := range sm.transitions[s] {
+				if next := sm.resolve(edge.To); !reachable[next] {
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	return reachable
+}
+
+// hasOutgoing 判断 state 或其祖先上是否有转换
+func (sm *StateMachine) hasOutgoing(state State) bool {
+	for _, s := range sm.ancestry(state) {
+		if len(sm.transitions[s]) > 0 {
+			return true
+		}
+	}
+	return false
+}
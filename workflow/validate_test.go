@@ -0,0 +1,98 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kekexiaoai/ticket/model"
+)
+
+func TestStateMachine_Validate(t *testing.T) {
+	if err := NewStateMachine().Validate(); err != nil {
+		t.Errorf("NewStateMachine().Validate() error = %v", err)
+	}
+
+	def, err := ParseDefinition([]byte(`
+initial: New
+events: [Submit, Approve, Reopen, Expire, Unused]
+states:
+  - name: New
+  - name: Pending
+    timers:
+      - {name: Expiry, after: 1h, event: Expire}
+  - name: Done
+    terminal: true
+  - name: Stuck
+  - name: Orphan
+    on_enter: [Noop]
+transitions:
+  - {from: New, event: Submit, to: Pending}
+  - {from: Pending, event: Approve, to: Done}
+  - {from: Pending, event: Reopen, to: Stuck}
+  - {from: Orphan, event: Approve, to: Done}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noop := Task{Name: "Noop", Execute: func(ctx context.Context, ticket *model.Ticket, event Event, payload model.Payload) error { return nil }}
+	sm, err := NewStateMachineFromDefinition(def, NewTaskRegistry(noop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.RegisterTasks("Pendng", nil, nil, []Task{noop}, nil, nil)
+	sm.RegisterTasks("Done", nil, nil, nil, []Task{noop}, nil)
+
+	err = sm.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidWorkflow) {
+		t.Fatalf("Validate() error = %v, want *ValidationError", err)
+	}
+	var got []string
+	for _, issue := range verr.Issues {
+		got = append(got, string(issue.Kind)+" "+string(issue.State)+string(issue.Event))
+	}
+	want := []string{
+		"terminal-on-exit Done",
+		"unreachable Orphan",
+		"timer-event PendingExpire",
+		"unknown-state Pendng",
+		"dead-end Stuck",
+		"unused-event Expire",
+		"unused-event Unused",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() issues = %v, want %v", got, want)
+	}
+}
+
+func TestStateMachine_ValidateSubStates(t *testing.T) {
+	// OnHold 只能从 Working 到达；外层 InProgress 上的转换在子状态中同样可用
+	def, err := ParseDefinition([]byte(`
+states:
+  - name: New
+  - name: InProgress
+    initial: Working
+  - name: Working
+    parent: InProgress
+  - name: OnHold
+    parent: InProgress
+  - name: Done
+    terminal: true
+transitions:
+  - {from: New, event: Start, to: InProgress}
+  - {from: Working, event: Hold, to: OnHold}
+  - {from: InProgress, event: Finish, to: Done}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewStateMachineFromDefinition(def, NewTaskRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}